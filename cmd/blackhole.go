@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/natesales/pathvector/pkg/process"
+	"github.com/natesales/pathvector/pkg/util"
+)
+
+var (
+	blackholeTTL   time.Duration
+	blackholePeers []string
+)
+
+func init() {
+	blackholeAddCmd.Flags().DurationVar(&blackholeTTL, "ttl", time.Hour, "Time until the blackhole request is withdrawn")
+	blackholeAddCmd.Flags().StringSliceVar(&blackholePeers, "peers", nil, "Peers to announce the blackhole to by name, tag:name or asn:number (all peers if empty)")
+	blackholeCmd.AddCommand(blackholeAddCmd)
+	blackholeCmd.AddCommand(blackholeRemoveCmd)
+	blackholeCmd.AddCommand(blackholeListCmd)
+	blackholeCmd.AddCommand(blackholeExpireCmd)
+	rootCmd.AddCommand(blackholeCmd)
+}
+
+var blackholeCmd = &cobra.Command{
+	Use:   "blackhole",
+	Short: "Manage RTBH blackhole requests",
+}
+
+var blackholeAddCmd = &cobra.Command{
+	Use:   "add <prefix>",
+	Short: "Announce a prefix with the blackhole community and regenerate the configuration",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		c, err := loadConfig()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if dryRun {
+			log.Infof("Dry run, not adding blackhole request for %s", args[0])
+			return
+		}
+		if err := process.AddBlackhole(c, args[0], blackholePeers, blackholeTTL); err != nil {
+			log.Fatal(err)
+		}
+		log.Infof("Added blackhole request for %s expiring in %s", args[0], blackholeTTL)
+		process.Run(configFile, lockFile, version, noConfigure, dryRun, false)
+	},
+}
+
+var blackholeRemoveCmd = &cobra.Command{
+	Use:     "remove <prefix>",
+	Short:   "Withdraw a blackhole request and regenerate the configuration",
+	Aliases: []string{"rm"},
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		c, err := loadConfig()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if dryRun {
+			log.Infof("Dry run, not removing blackhole request for %s", args[0])
+			return
+		}
+		if err := process.RemoveBlackhole(c.CacheDirectory, args[0]); err != nil {
+			log.Fatal(err)
+		}
+		log.Infof("Removed blackhole request for %s", args[0])
+		process.Run(configFile, lockFile, version, noConfigure, dryRun, false)
+	},
+}
+
+var blackholeListCmd = &cobra.Command{
+	Use:     "list",
+	Short:   "List blackhole requests",
+	Aliases: []string{"ls"},
+	Run: func(cmd *cobra.Command, args []string) {
+		c, err := loadConfig()
+		if err != nil {
+			log.Fatal(err)
+		}
+		requests, err := process.LoadBlackholes(c.CacheDirectory)
+		if err != nil {
+			log.Fatalf("Reading blackhole requests: %s", err)
+		}
+		prefixes := make([]string, 0, len(requests))
+		for prefix := range requests {
+			prefixes = append(prefixes, prefix)
+		}
+		sort.Strings(prefixes)
+
+		util.PrintTable([]string{"Prefix", "Peers", "Expires"}, func() [][]string {
+			var table [][]string
+			for _, prefix := range prefixes {
+				peers := "all"
+				if len(requests[prefix].Peers) > 0 {
+					peers = strings.Join(requests[prefix].Peers, ", ")
+				}
+				table = append(table, []string{prefix, peers, requests[prefix].Expires.Format(time.RFC3339)})
+			}
+			return table
+		}())
+	},
+}
+
+var blackholeExpireCmd = &cobra.Command{
+	Use:   "expire",
+	Short: "Withdraw expired blackhole requests, regenerating the configuration only if any expired",
+	Run: func(cmd *cobra.Command, args []string) {
+		c, err := loadConfig()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if dryRun {
+			log.Info("Dry run, not withdrawing expired blackhole requests")
+			return
+		}
+		expired, err := process.ExpireBlackholes(c.CacheDirectory, time.Now())
+		if err != nil {
+			log.Fatal(err)
+		}
+		if expired == 0 {
+			log.Debug("No expired blackhole requests")
+			return
+		}
+		process.Run(configFile, lockFile, version, noConfigure, dryRun, false)
+	},
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"io"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/natesales/pathvector/pkg/bmp"
+)
+
+var (
+	bmpListen string
+	bmpOutput string
+	bmpRead   string
+)
+
+func init() {
+	bmpCmd.Flags().StringVarP(&bmpListen, "listen", "l", ":1790", "Address to accept BMP sessions on")
+	bmpCmd.Flags().StringVarP(&bmpOutput, "output", "o", "-", "File to append JSON lines to (- for stdout)")
+	bmpCmd.Flags().StringVarP(&bmpRead, "read", "r", "", "Decode a recorded BMP capture file instead of listening")
+	rootCmd.AddCommand(bmpCmd)
+}
+
+var bmpCmd = &cobra.Command{
+	Use:   "bmp",
+	Short: "Receive BMP route monitoring messages and write them as JSON lines",
+	Run: func(cmd *cobra.Command, args []string) {
+		var out io.Writer = os.Stdout
+		if bmpOutput != "-" {
+			//nolint:golint,gosec
+			f, err := os.OpenFile(bmpOutput, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+			if err != nil {
+				log.Fatalf("Opening output file: %s", err)
+			}
+			defer f.Close()
+			out = f
+		}
+
+		if bmpRead != "" {
+			f, err := os.Open(bmpRead)
+			if err != nil {
+				log.Fatalf("Opening BMP capture: %s", err)
+			}
+			defer f.Close()
+			if err := bmp.Process(f, out); err != nil {
+				log.Fatalf("Decoding BMP capture: %s", err)
+			}
+			return
+		}
+
+		if err := bmp.Listen(bmpListen, out); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"os"
+	"path"
+	"testing"
+)
+
+func TestBMPRead(t *testing.T) {
+	output := path.Join(t.TempDir(), "bmp.jsonl")
+	rootCmd.SetArgs([]string{
+		"bmp",
+		"-r", "../tests/bmp/bird.bmp",
+		"-o", output,
+	})
+	if err := rootCmd.Execute(); err != nil {
+		t.Error(err)
+	}
+
+	expected, err := os.ReadFile("../tests/bmp/bird.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(expected) != string(actual) {
+		t.Errorf("expected %s, got %s", expected, actual)
+	}
+}
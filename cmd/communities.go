@@ -0,0 +1,26 @@
+package cmd
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/natesales/pathvector/pkg/process"
+)
+
+func init() {
+	rootCmd.AddCommand(communitiesCmd)
+}
+
+var communitiesCmd = &cobra.Command{
+	Use:   "communities",
+	Short: "Generate customer documentation of action communities",
+	Run: func(cmd *cobra.Command, args []string) {
+		c, err := loadConfig()
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Print(process.ActionCommunityDocs(c))
+	},
+}
@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/natesales/pathvector/pkg/config"
+	"github.com/natesales/pathvector/pkg/process"
+	"github.com/natesales/pathvector/pkg/util"
+)
+
+var (
+	flowspecRule config.FlowspecRule
+	flowspecTTL  time.Duration
+)
+
+func init() {
+	flowspecAddCmd.Flags().StringVar(&flowspecRule.Destination, "destination", "", "Destination prefix to match")
+	flowspecAddCmd.Flags().StringVar(&flowspecRule.Source, "source", "", "Source prefix to match")
+	flowspecAddCmd.Flags().StringVar(&flowspecRule.Protocol, "protocol", "", "IP protocol to match (tcp, udp, icmp, icmpv6, gre, esp or protocol number)")
+	flowspecAddCmd.Flags().StringSliceVar(&flowspecRule.DestinationPorts, "destination-port", nil, "Destination port or port range to match (repeatable)")
+	flowspecAddCmd.Flags().StringSliceVar(&flowspecRule.SourcePorts, "source-port", nil, "Source port or port range to match (repeatable)")
+	flowspecAddCmd.Flags().StringSliceVar(&flowspecRule.PacketLengths, "packet-length", nil, "Packet length or length range to match (repeatable)")
+	flowspecAddCmd.Flags().StringVar(&flowspecRule.Action, "action", process.FlowspecDiscard, "Action to take on matching traffic (discard, rate-limit, redirect)")
+	flowspecAddCmd.Flags().Float32Var(&flowspecRule.RateLimit, "rate-limit", 0, "Rate limit in bytes per second for the rate-limit action")
+	flowspecAddCmd.Flags().StringVar(&flowspecRule.Redirect, "redirect", "", "Route target (ASN:value) of the VRF to redirect traffic to for the redirect action")
+	flowspecAddCmd.Flags().DurationVar(&flowspecTTL, "ttl", time.Hour, "Time until the rule is withdrawn")
+	flowspecCmd.AddCommand(flowspecAddCmd)
+	flowspecCmd.AddCommand(flowspecRemoveCmd)
+	flowspecCmd.AddCommand(flowspecListCmd)
+	rootCmd.AddCommand(flowspecCmd)
+}
+
+var flowspecCmd = &cobra.Command{
+	Use:   "flowspec",
+	Short: "Manage temporary flowspec rules",
+}
+
+var flowspecAddCmd = &cobra.Command{
+	Use:   "add <name>",
+	Short: "Add a temporary flowspec rule and regenerate the configuration",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		c, err := loadConfig()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if dryRun {
+			log.Infof("Dry run, not adding flowspec rule %s", args[0])
+			return
+		}
+		if err := process.AddFlowspecRule(c, args[0], &flowspecRule, flowspecTTL); err != nil {
+			log.Fatal(err)
+		}
+		log.Infof("Added flowspec rule %s expiring in %s", args[0], flowspecTTL)
+		process.Run(configFile, lockFile, version, noConfigure, dryRun, false)
+	},
+}
+
+var flowspecRemoveCmd = &cobra.Command{
+	Use:     "remove <name>",
+	Short:   "Remove a temporary flowspec rule and regenerate the configuration",
+	Aliases: []string{"rm"},
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		c, err := loadConfig()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if dryRun {
+			log.Infof("Dry run, not removing flowspec rule %s", args[0])
+			return
+		}
+		if err := process.RemoveFlowspecRule(c.CacheDirectory, args[0]); err != nil {
+			log.Fatal(err)
+		}
+		log.Infof("Removed flowspec rule %s", args[0])
+		process.Run(configFile, lockFile, version, noConfigure, dryRun, false)
+	},
+}
+
+var flowspecListCmd = &cobra.Command{
+	Use:     "list",
+	Short:   "List flowspec rules",
+	Aliases: []string{"ls"},
+	Run: func(cmd *cobra.Command, args []string) {
+		c, err := loadConfig()
+		if err != nil {
+			log.Fatal(err)
+		}
+		temporary, err := process.LoadFlowspecRules(c.CacheDirectory)
+		if err != nil {
+			log.Fatalf("Reading temporary flowspec rules: %s", err)
+		}
+
+		rules := map[string]*config.FlowspecRule{}
+		expires := map[string]string{}
+		for name, rule := range c.Flowspec {
+			rules[name] = rule
+			expires[name] = "never"
+		}
+		for name, rule := range temporary {
+			rules[name] = rule.Rule
+			expires[name] = rule.Expires.Format(time.RFC3339)
+		}
+		names := make([]string, 0, len(rules))
+		for name := range rules {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		util.PrintTable([]string{"Name", "Destination", "Source", "Protocol", "Action", "Expires"}, func() [][]string {
+			var table [][]string
+			for _, name := range names {
+				rule := rules[name]
+				table = append(table, []string{name, rule.Destination, rule.Source, rule.Protocol, rule.Action, expires[name]})
+			}
+			return table
+		}())
+	},
+}
@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/natesales/pathvector/pkg/process"
+)
+
+var (
+	outputDirectory string
+	stateDirectory  string
+	validate        bool
+)
+
+func init() {
+	generateAllCmd.Flags().StringVarP(&outputDirectory, "output", "o", "output", "Directory to write a BIRD config directory for each router to")
+	generateAllCmd.Flags().StringVar(&stateDirectory, "state", "", "Directory containing a directory of runtime state for each router (validation only if not set)")
+	generateAllCmd.Flags().BoolVar(&validate, "validate", true, "Validate each router's BIRD config")
+	rootCmd.AddCommand(generateAllCmd)
+}
+
+var generateAllCmd = &cobra.Command{
+	Use:   "generate-all",
+	Short: "Generate configuration of all routers in the routers inventory",
+	Run: func(cmd *cobra.Command, args []string) {
+		process.RunAll(configFile, outputDirectory, stateDirectory, version, validate)
+	},
+}
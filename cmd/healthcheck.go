@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/natesales/pathvector/pkg/healthcheck"
+)
+
+func init() {
+	rootCmd.AddCommand(healthcheckCmd)
+}
+
+var healthcheckCmd = &cobra.Command{
+	Use:   "healthcheck",
+	Short: "Start anycast health check daemon",
+	Run: func(cmd *cobra.Command, args []string) {
+		c, err := loadConfig()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		log.Infof("Starting health checks for %d anycast prefixes", len(c.Anycast))
+		if err := healthcheck.Run(c, noConfigure); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
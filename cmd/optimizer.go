@@ -2,14 +2,30 @@ package cmd
 
 import (
 	"fmt"
+	"os"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 
+	"github.com/natesales/pathvector/pkg/config"
 	"github.com/natesales/pathvector/pkg/optimizer"
+	"github.com/natesales/pathvector/pkg/process"
+	"github.com/natesales/pathvector/pkg/util"
+)
+
+var (
+	historySince time.Duration
+	historyPeer  string
+	statusURL    string
 )
 
 func init() {
+	optimizerHistoryCmd.Flags().DurationVarP(&historySince, "since", "s", 24*time.Hour, "Show probe results newer than this duration")
+	optimizerHistoryCmd.Flags().StringVarP(&historyPeer, "peer", "p", "", "Only show probe results for this peer name or ASN")
+	optimizerCmd.AddCommand(optimizerHistoryCmd)
+	optimizerStatusCmd.Flags().StringVarP(&statusURL, "url", "u", "", "HTTP URL of the optimizer status server (defaults to the optimizer status socket)")
+	optimizerCmd.AddCommand(optimizerStatusCmd)
 	rootCmd.AddCommand(optimizerCmd)
 }
 
@@ -33,8 +49,91 @@ var optimizerCmd = &cobra.Command{
 		if len(sourceMap) == 0 {
 			log.Fatal("No peers have optimization enabled, exiting now")
 		}
-		if err := optimizer.StartProbe(c.Optimizer, sourceMap, c, noConfigure, dryRun); err != nil {
+		reload := func() (*config.Config, error) {
+			configBytes, err := os.ReadFile(configFile)
+			if err != nil {
+				return nil, err
+			}
+			return process.Load(configBytes)
+		}
+		if err := optimizer.StartProbe(c.Optimizer, sourceMap, c, reload, noConfigure, dryRun); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+var optimizerHistoryCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Show historical probe results",
+	Run: func(cmd *cobra.Command, args []string) {
+		c, err := loadConfig()
+		if err != nil {
 			log.Fatal(err)
 		}
+
+		records, err := optimizer.History(optimizer.DbPath(c.CacheDirectory), time.Now().Add(-historySince), historyPeer)
+		if err != nil {
+			log.Fatalf("Reading probe database: %s", err)
+		}
+
+		util.PrintTable([]string{"Time", "AS", "Peer", "Source", "Target", "Latency", "Loss"}, func() [][]string {
+			var table [][]string
+			for _, r := range records {
+				table = append(table, []string{
+					time.Unix(0, r.Time).Format(time.RFC3339),
+					r.ASN,
+					r.Peer,
+					r.Source,
+					r.Target,
+					r.Stats.AvgRtt.Round(time.Microsecond).String(),
+					fmt.Sprintf("%.1f%%", r.Stats.PacketLoss),
+				})
+			}
+			return table
+		}())
+	},
+}
+
+var optimizerStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the status of the running optimizer",
+	Run: func(cmd *cobra.Command, args []string) {
+		var socket string
+		if statusURL == "" {
+			c, err := loadConfig()
+			if err != nil {
+				log.Fatal(err)
+			}
+			socket = c.Optimizer.StatusSocket
+		}
+
+		status, err := optimizer.QueryStatus(socket, statusURL)
+		if err != nil {
+			log.Fatalf("Querying optimizer status: %s", err)
+		}
+
+		log.Infof("Optimizer status updated %s", status.Updated)
+		util.PrintTable([]string{"AS", "Peer", "Latency", "P95", "Jitter", "Loss", "Cache", "State", "Local Pref", "Last Adjustment"}, func() [][]string {
+			var table [][]string
+			for _, p := range status.Peers {
+				state := "healthy"
+				if p.Degraded {
+					state = "depreferred"
+				}
+				table = append(table, []string{
+					fmt.Sprintf("%d", p.ASN),
+					p.Peer,
+					fmt.Sprintf("%.2fms", p.Latency),
+					fmt.Sprintf("%.2fms", p.P95),
+					fmt.Sprintf("%.2fms", p.Jitter),
+					fmt.Sprintf("%.1f%%", p.PacketLoss),
+					fmt.Sprintf("%d/%d", p.CacheUsed, p.CacheSize),
+					state,
+					fmt.Sprintf("%d", p.LocalPref),
+					p.LastAdjustment,
+				})
+			}
+			return table
+		}())
 	},
 }
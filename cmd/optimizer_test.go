@@ -35,10 +35,10 @@ func TestOptimizer(t *testing.T) {
 		assert.Nil(t, rootCmd.Execute())
 
 		// Check if local pref is lowered
-		checkFile, err := os.ReadFile("test-cache/AS65510_EXAMPLE.conf")
+		checkFile, err := os.ReadFile("test-cache/optimizer.conf")
 		assert.Nil(t, err)
-		if !strings.Contains(string(checkFile), "bgp_local_pref = 80; # pathvector:localpref") {
-			t.Errorf("expected bgp_local_pref = 80 but not found in file")
+		if !strings.Contains(string(checkFile), "define AS65510_EXAMPLE_OPTIMIZER_LOCAL_PREF = 80") {
+			t.Errorf("expected AS65510_EXAMPLE_OPTIMIZER_LOCAL_PREF = 80 but not found in optimizer.conf")
 		}
 	}
 }
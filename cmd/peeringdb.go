@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/natesales/pathvector/pkg/peeringdb"
+)
+
+var snapshotFile string
+
+func init() {
+	peeringdbSyncCmd.Flags().StringVarP(&snapshotFile, "output", "o", "", "Snapshot file, will read from peeringdb-snapshot config option if empty")
+	peeringdbCmd.AddCommand(peeringdbSyncCmd)
+	rootCmd.AddCommand(peeringdbCmd)
+}
+
+var peeringdbCmd = &cobra.Command{
+	Use:   "peeringdb",
+	Short: "Manage local PeeringDB data",
+}
+
+var peeringdbSyncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Download a PeeringDB snapshot for offline use",
+	Run: func(cmd *cobra.Command, args []string) {
+		c, err := loadConfig()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if snapshotFile == "" {
+			snapshotFile = c.PeeringDBSnapshot
+		}
+		if snapshotFile == "" {
+			log.Fatal("No snapshot file specified, set peeringdb-snapshot or --output")
+		}
+
+		asns := []uint32{uint32(c.ASN)}
+		for _, peerData := range c.Peers {
+			asns = append(asns, uint32(*peerData.ASN))
+		}
+
+		log.Infof("Syncing PeeringDB snapshot for %d ASNs to %s", len(asns), snapshotFile)
+		s, err := peeringdb.Sync(asns, snapshotFile, c.PeeringDBQueryTimeout, c.PeeringDBAPIKey)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Infof("Wrote %d networks, %d netixlans and %d IXs to %s", len(s.Networks), len(s.NetIXLANs), len(s.IXs), snapshotFile)
+	},
+}
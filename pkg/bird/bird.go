@@ -23,6 +23,9 @@ import (
 // Minimum supported BIRD version
 const supportedMin = "2.0.7"
 
+// BMPMin is the minimum BIRD version with BMP support
+const BMPMin = "2.14"
+
 // isNumeric checks if a byte is character for number
 func isNumeric(b byte) bool {
 	return b >= byte('0') && b <= byte('9')
@@ -135,6 +138,27 @@ func RunCommand(command string, socket string) (string, string, error) {
 	return resp, birdVersion, nil // nil error
 }
 
+// BinaryVersion returns the version of a BIRD binary
+func BinaryVersion(binary string) (string, error) {
+	var out bytes.Buffer
+	birdCmd := exec.Command(binary, "--version")
+	birdCmd.Stdout = &out
+	birdCmd.Stderr = &out
+	if err := birdCmd.Run(); err != nil {
+		return "", err
+	}
+	fields := strings.Fields(out.String())
+	if len(fields) == 0 {
+		return "", fmt.Errorf("unexpected BIRD version output")
+	}
+	return fields[len(fields)-1], nil
+}
+
+// SupportsBMP returns if a BIRD version supports the BMP protocol
+func SupportsBMP(version string) bool {
+	return semver.Compare("v"+strings.TrimPrefix(version, "v"), "v"+BMPMin) >= 0
+}
+
 // Validate checks if the cached configuration is syntactically valid
 func Validate(binary string, cacheDir string) {
 	log.Debugf("Validating BIRD config")
@@ -242,15 +266,20 @@ func MoveCacheAndReconfigure(birdDirectory string, cacheDirectory string, birdSo
 	}
 
 	if !noConfigure {
-		log.Info("Reconfiguring BIRD")
-		resp, _, err := RunCommand("configure", birdSocket)
-		if err != nil {
-			log.Fatal(err)
-		}
-		// Print bird output as multiple lines
-		for _, line := range strings.Split(strings.Trim(resp, "\n"), "\n") {
-			log.Printf("BIRD response (multiline): %s", line)
-		}
+		Reconfigure(birdSocket)
+	}
+}
+
+// Reconfigure tells BIRD to reload its configuration files
+func Reconfigure(birdSocket string) {
+	log.Info("Reconfiguring BIRD")
+	resp, _, err := RunCommand("configure", birdSocket)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Print bird output as multiple lines
+	for _, line := range strings.Split(strings.Trim(resp, "\n"), "\n") {
+		log.Printf("BIRD response (multiline): %s", line)
 	}
 }
 
@@ -488,3 +488,11 @@ func TestBirdProtocolParseRoutes(t *testing.T) {
 		assert.Equal(t, tc.Routes, routes)
 	}
 }
+
+func TestSupportsBMP(t *testing.T) {
+	assert.True(t, SupportsBMP("2.14"))
+	assert.True(t, SupportsBMP("2.15.1"))
+	assert.True(t, SupportsBMP("3.0.0"))
+	assert.False(t, SupportsBMP("2.13.1"))
+	assert.False(t, SupportsBMP("2.0.7"))
+}
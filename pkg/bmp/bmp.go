@@ -0,0 +1,424 @@
+package bmp
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// BMP message types (RFC 7854)
+const (
+	MsgRouteMonitoring  = 0
+	MsgStatisticsReport = 1
+	MsgPeerDown         = 2
+	MsgPeerUp           = 3
+	MsgInitiation       = 4
+	MsgTermination      = 5
+	MsgRouteMirroring   = 6
+)
+
+// Event types
+const (
+	EventUpdate   = "update"
+	EventPeerUp   = "peer_up"
+	EventPeerDown = "peer_down"
+)
+
+const (
+	commonHeaderLength = 6
+	peerHeaderLength   = 42
+	bgpHeaderLength    = 19
+	maxMessageLength   = 1024 * 1024
+
+	// Per-peer header flags
+	flagIPv6       = 0x80
+	flagPostPolicy = 0x40
+	flagASPath2    = 0x20
+
+	// BGP path attribute flags and types
+	attrFlagExtendedLength = 0x10
+	attrOrigin             = 1
+	attrASPath             = 2
+	attrNextHop            = 3
+	attrMED                = 4
+	attrLocalPref          = 5
+	attrCommunities        = 8
+	attrMPReachNLRI        = 14
+	attrMPUnreachNLRI      = 15
+	attrLargeCommunities   = 32
+
+	afiIPv4     = 1
+	afiIPv6     = 2
+	safiUnicast = 1
+)
+
+// Event is a decoded BMP message about a single monitored peer
+type Event struct {
+	Type             string   `json:"type"`
+	Time             string   `json:"time"`
+	Peer             string   `json:"peer"`
+	PeerASN          uint32   `json:"peer_asn"`
+	PeerBGPID        string   `json:"peer_bgp_id"`
+	PostPolicy       bool     `json:"post_policy"`
+	Announced        []string `json:"announced,omitempty"`
+	Withdrawn        []string `json:"withdrawn,omitempty"`
+	NextHop          string   `json:"next_hop,omitempty"`
+	Origin           string   `json:"origin,omitempty"`
+	ASPath           []uint32 `json:"as_path,omitempty"`
+	MED              *uint32  `json:"med,omitempty"`
+	LocalPref        *uint32  `json:"local_pref,omitempty"`
+	Communities      []string `json:"communities,omitempty"`
+	LargeCommunities []string `json:"large_communities,omitempty"`
+	LocalAddress     string   `json:"local_address,omitempty"`
+	Reason           uint8    `json:"reason,omitempty"`
+}
+
+// peerHeader is a BMP per-peer header
+type peerHeader struct {
+	flags   uint8
+	address net.IP
+	asn     uint32
+	bgpID   net.IP
+	time    time.Time
+}
+
+// ReadMessage reads a single BMP message from a stream and returns its type and body
+func ReadMessage(r io.Reader) (uint8, []byte, error) {
+	header := make([]byte, commonHeaderLength)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+	if header[0] != 3 {
+		return 0, nil, fmt.Errorf("unsupported BMP version %d", header[0])
+	}
+	length := binary.BigEndian.Uint32(header[1:5])
+	if length < commonHeaderLength || length > maxMessageLength {
+		return 0, nil, fmt.Errorf("invalid BMP message length %d", length)
+	}
+
+	body := make([]byte, length-commonHeaderLength)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, fmt.Errorf("reading BMP message: %s", err)
+	}
+	return header[5], body, nil
+}
+
+// Decode decodes the body of a BMP message. Message types that don't describe a monitored peer's routes or session
+// state return a nil event.
+func Decode(msgType uint8, body []byte) (*Event, error) {
+	switch msgType {
+	case MsgRouteMonitoring, MsgPeerUp, MsgPeerDown:
+	default:
+		return nil, nil
+	}
+
+	ph, rest, err := parsePeerHeader(body)
+	if err != nil {
+		return nil, err
+	}
+	event := &Event{
+		Time:       ph.time.UTC().Format(time.RFC3339Nano),
+		Peer:       ph.address.String(),
+		PeerASN:    ph.asn,
+		PeerBGPID:  ph.bgpID.String(),
+		PostPolicy: ph.flags&flagPostPolicy != 0,
+	}
+
+	switch msgType {
+	case MsgRouteMonitoring:
+		event.Type = EventUpdate
+		if err := parseUpdate(rest, event, ph.flags&flagASPath2 != 0); err != nil {
+			return nil, err
+		}
+	case MsgPeerUp:
+		event.Type = EventPeerUp
+		if len(rest) < 16 {
+			return nil, errors.New("peer up message too short")
+		}
+		event.LocalAddress = parseAddress(rest[:16], ph.flags&flagIPv6 != 0).String()
+	case MsgPeerDown:
+		event.Type = EventPeerDown
+		if len(rest) < 1 {
+			return nil, errors.New("peer down message too short")
+		}
+		event.Reason = rest[0]
+	}
+	return event, nil
+}
+
+// parseAddress parses a 16 byte BMP address field, with IPv4 addresses stored in the last 4 bytes
+func parseAddress(b []byte, ipv6 bool) net.IP {
+	if ipv6 {
+		return net.IP(append([]byte{}, b[:16]...))
+	}
+	return net.IPv4(b[12], b[13], b[14], b[15]).To4()
+}
+
+// parsePeerHeader parses a BMP per-peer header and returns the remainder of the message
+func parsePeerHeader(b []byte) (*peerHeader, []byte, error) {
+	if len(b) < peerHeaderLength {
+		return nil, nil, errors.New("per-peer header too short")
+	}
+	ph := &peerHeader{
+		flags:   b[1],
+		asn:     binary.BigEndian.Uint32(b[26:30]),
+		bgpID:   net.IP(append([]byte{}, b[30:34]...)),
+		address: parseAddress(b[10:26], b[1]&flagIPv6 != 0),
+	}
+	seconds, micros := binary.BigEndian.Uint32(b[34:38]), binary.BigEndian.Uint32(b[38:42])
+	if seconds == 0 {
+		ph.time = time.Now()
+	} else {
+		ph.time = time.Unix(int64(seconds), int64(micros)*int64(time.Microsecond))
+	}
+	return ph, b[peerHeaderLength:], nil
+}
+
+// parsePrefixes parses a list of NLRI prefixes of an address family
+func parsePrefixes(b []byte, afi uint16) ([]string, error) {
+	size := net.IPv4len
+	if afi == afiIPv6 {
+		size = net.IPv6len
+	}
+
+	var prefixes []string
+	for len(b) > 0 {
+		bits := int(b[0])
+		octets := (bits + 7) / 8
+		if bits > size*8 || len(b) < 1+octets {
+			return nil, fmt.Errorf("invalid prefix length %d", bits)
+		}
+		ip := make(net.IP, size)
+		copy(ip, b[1:1+octets])
+		prefixes = append(prefixes, (&net.IPNet{IP: ip, Mask: net.CIDRMask(bits, size*8)}).String())
+		b = b[1+octets:]
+	}
+	return prefixes, nil
+}
+
+// parseUpdate parses a BGP UPDATE message into an event
+func parseUpdate(b []byte, event *Event, asPath2 bool) error {
+	if len(b) < bgpHeaderLength+4 {
+		return errors.New("BGP update too short")
+	}
+	if b[18] != 2 {
+		return fmt.Errorf("unexpected BGP message type %d in route monitoring message", b[18])
+	}
+	length := int(binary.BigEndian.Uint16(b[16:18]))
+	if length < bgpHeaderLength+4 || length > len(b) {
+		return fmt.Errorf("invalid BGP update length %d", length)
+	}
+	b = b[bgpHeaderLength:length]
+
+	withdrawnLength := int(binary.BigEndian.Uint16(b[0:2]))
+	if len(b) < 2+withdrawnLength+2 {
+		return errors.New("invalid withdrawn routes length")
+	}
+	withdrawn, err := parsePrefixes(b[2:2+withdrawnLength], afiIPv4)
+	if err != nil {
+		return err
+	}
+	event.Withdrawn = append(event.Withdrawn, withdrawn...)
+	b = b[2+withdrawnLength:]
+
+	attrsLength := int(binary.BigEndian.Uint16(b[0:2]))
+	if len(b) < 2+attrsLength {
+		return errors.New("invalid path attributes length")
+	}
+	if err := parseAttributes(b[2:2+attrsLength], event, asPath2); err != nil {
+		return err
+	}
+
+	announced, err := parsePrefixes(b[2+attrsLength:], afiIPv4)
+	if err != nil {
+		return err
+	}
+	event.Announced = append(event.Announced, announced...)
+	return nil
+}
+
+// parseAttributes parses BGP path attributes into an event
+func parseAttributes(b []byte, event *Event, asPath2 bool) error {
+	for len(b) > 0 {
+		if len(b) < 3 {
+			return errors.New("path attribute too short")
+		}
+		flags, attrType := b[0], b[1]
+		var length, offset int
+		if flags&attrFlagExtendedLength != 0 {
+			if len(b) < 4 {
+				return errors.New("path attribute too short")
+			}
+			length, offset = int(binary.BigEndian.Uint16(b[2:4])), 4
+		} else {
+			length, offset = int(b[2]), 3
+		}
+		if len(b) < offset+length {
+			return fmt.Errorf("invalid length %d of path attribute %d", length, attrType)
+		}
+		value := b[offset : offset+length]
+		b = b[offset+length:]
+
+		switch attrType {
+		case attrOrigin:
+			if len(value) == 1 {
+				event.Origin = map[byte]string{0: "igp", 1: "egp", 2: "incomplete"}[value[0]]
+			}
+		case attrASPath:
+			asnSize := 4
+			if asPath2 {
+				asnSize = 2
+			}
+			for len(value) >= 2 {
+				count := int(value[1])
+				if len(value) < 2+count*asnSize {
+					return errors.New("invalid AS path segment")
+				}
+				for i := 0; i < count; i++ {
+					asn := value[2+i*asnSize : 2+(i+1)*asnSize]
+					if asPath2 {
+						event.ASPath = append(event.ASPath, uint32(binary.BigEndian.Uint16(asn)))
+					} else {
+						event.ASPath = append(event.ASPath, binary.BigEndian.Uint32(asn))
+					}
+				}
+				value = value[2+count*asnSize:]
+			}
+		case attrNextHop:
+			if len(value) == net.IPv4len {
+				event.NextHop = net.IP(value).String()
+			}
+		case attrMED:
+			if len(value) == 4 {
+				med := binary.BigEndian.Uint32(value)
+				event.MED = &med
+			}
+		case attrLocalPref:
+			if len(value) == 4 {
+				localPref := binary.BigEndian.Uint32(value)
+				event.LocalPref = &localPref
+			}
+		case attrCommunities:
+			for i := 0; i+4 <= len(value); i += 4 {
+				event.Communities = append(event.Communities, fmt.Sprintf("%d:%d",
+					binary.BigEndian.Uint16(value[i:i+2]), binary.BigEndian.Uint16(value[i+2:i+4])))
+			}
+		case attrLargeCommunities:
+			for i := 0; i+12 <= len(value); i += 12 {
+				event.LargeCommunities = append(event.LargeCommunities, fmt.Sprintf("%d:%d:%d",
+					binary.BigEndian.Uint32(value[i:i+4]), binary.BigEndian.Uint32(value[i+4:i+8]), binary.BigEndian.Uint32(value[i+8:i+12])))
+			}
+		case attrMPReachNLRI:
+			if len(value) < 5 {
+				return errors.New("MP_REACH_NLRI too short")
+			}
+			afi, safi, nextHopLength := binary.BigEndian.Uint16(value[0:2]), value[2], int(value[3])
+			if len(value) < 4+nextHopLength+1 {
+				return errors.New("invalid MP_REACH_NLRI next hop length")
+			}
+			if safi != safiUnicast {
+				continue
+			}
+			// IPv6 next hops may be followed by a link-local next hop
+			if nextHopLength >= net.IPv6len {
+				event.NextHop = net.IP(value[4 : 4+net.IPv6len]).String()
+			} else if nextHopLength == net.IPv4len {
+				event.NextHop = net.IP(value[4 : 4+net.IPv4len]).String()
+			}
+			announced, err := parsePrefixes(value[4+nextHopLength+1:], afi)
+			if err != nil {
+				return err
+			}
+			event.Announced = append(event.Announced, announced...)
+		case attrMPUnreachNLRI:
+			if len(value) < 3 {
+				return errors.New("MP_UNREACH_NLRI too short")
+			}
+			if value[2] != safiUnicast {
+				continue
+			}
+			withdrawn, err := parsePrefixes(value[3:], binary.BigEndian.Uint16(value[0:2]))
+			if err != nil {
+				return err
+			}
+			event.Withdrawn = append(event.Withdrawn, withdrawn...)
+		}
+	}
+	return nil
+}
+
+// lockedWriter serializes writes from multiple BMP sessions
+type lockedWriter struct {
+	lock sync.Mutex
+	w    io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.w.Write(p)
+}
+
+// Process decodes a stream of BMP messages and writes an event for each route monitoring, peer up and peer down
+// message to w as a JSON line. Messages that can't be decoded are logged and skipped.
+func Process(r io.Reader, w io.Writer) error {
+	for {
+		msgType, body, err := ReadMessage(r)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+
+		event, err := Decode(msgType, body)
+		if err != nil {
+			log.Warnf("[BMP] Skipping message type %d: %s", msgType, err)
+			continue
+		}
+		if event == nil {
+			log.Debugf("[BMP] Ignoring message type %d", msgType)
+			continue
+		}
+
+		j, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(append(j, '\n')); err != nil {
+			return err
+		}
+	}
+}
+
+// Listen accepts BMP sessions on a TCP address and writes events from every session to w
+func Listen(address string, w io.Writer) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	log.Infof("[BMP] Listening on %s", address)
+
+	out := &lockedWriter{w: w}
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go func(conn net.Conn) {
+			defer conn.Close()
+			log.Infof("[BMP] Session from %s started", conn.RemoteAddr())
+			if err := Process(conn, out); err != nil {
+				log.Warnf("[BMP] Session from %s: %s", conn.RemoteAddr(), err)
+			}
+			log.Infof("[BMP] Session from %s closed", conn.RemoteAddr())
+		}(conn)
+	}
+}
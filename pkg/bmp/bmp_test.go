@@ -0,0 +1,95 @@
+package bmp
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessCaptures(t *testing.T) {
+	captures, err := filepath.Glob("../../tests/bmp/*.bmp")
+	assert.Nil(t, err)
+	assert.NotEmpty(t, captures)
+	for _, capture := range captures {
+		f, err := os.Open(capture)
+		assert.Nil(t, err)
+		var out bytes.Buffer
+		assert.Nilf(t, Process(f, &out), "capture %s", capture)
+		_ = f.Close()
+
+		expected, err := os.ReadFile(strings.TrimSuffix(capture, ".bmp") + ".jsonl")
+		assert.Nil(t, err)
+		assert.Equalf(t, string(expected), out.String(), "capture %s", capture)
+	}
+}
+
+func TestProcessInvalid(t *testing.T) {
+	capture, err := os.ReadFile("../../tests/bmp/bird.bmp")
+	assert.Nil(t, err)
+
+	// Truncated message
+	assert.NotNil(t, Process(bytes.NewReader(capture[:len(capture)-3]), &bytes.Buffer{}))
+
+	// Unsupported version
+	assert.NotNil(t, Process(bytes.NewReader([]byte{1, 0, 0, 0, 6, 4}), &bytes.Buffer{}))
+
+	// Route monitoring message with a truncated per-peer header is skipped
+	var out bytes.Buffer
+	assert.Nil(t, Process(bytes.NewReader([]byte{3, 0, 0, 0, 10, 0, 0, 0, 0, 0}), &out))
+	assert.Empty(t, out.String())
+}
+
+func TestParsePrefixes(t *testing.T) {
+	prefixes, err := parsePrefixes([]byte{24, 192, 0, 2, 0, 32, 198, 51, 100, 1}, afiIPv4)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"192.0.2.0/24", "0.0.0.0/0", "198.51.100.1/32"}, prefixes)
+
+	prefixes, err = parsePrefixes([]byte{32, 0x20, 0x01, 0x0d, 0xb8}, afiIPv6)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"2001:db8::/32"}, prefixes)
+
+	_, err = parsePrefixes([]byte{33, 192, 0, 2, 0, 0}, afiIPv4)
+	assert.NotNil(t, err)
+	_, err = parsePrefixes([]byte{24, 192, 0}, afiIPv4)
+	assert.NotNil(t, err)
+}
+
+func TestListen(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	address := listener.Addr().String()
+	assert.Nil(t, listener.Close())
+
+	out := &lockedWriter{w: &bytes.Buffer{}}
+	go func() {
+		_ = Listen(address, out)
+	}()
+
+	capture, err := os.ReadFile("../../tests/bmp/bird.bmp")
+	assert.Nil(t, err)
+	var conn net.Conn
+	for i := 0; i < 50; i++ {
+		if conn, err = net.Dial("tcp", address); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Nil(t, err)
+	_, err = conn.Write(capture)
+	assert.Nil(t, err)
+	assert.Nil(t, conn.Close())
+
+	expected, err := os.ReadFile("../../tests/bmp/bird.jsonl")
+	assert.Nil(t, err)
+	assert.Eventually(t, func() bool {
+		out.lock.Lock()
+		defer out.lock.Unlock()
+		return out.w.(*bytes.Buffer).String() == string(expected)
+	}, time.Second, 10*time.Millisecond)
+}
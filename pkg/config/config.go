@@ -125,6 +125,7 @@ type Peer struct {
 	Password               *string   `yaml:"password" description:"BGP MD5 password" default:"-"`
 	RSClient               *bool     `yaml:"rs-client" description:"Should this peer be a route server client?" default:"false"`
 	RRClient               *bool     `yaml:"rr-client" description:"Should this peer be a route reflector client?" default:"false"`
+	RRClusterID            *string   `yaml:"rr-cluster-id" description:"Route reflector cluster ID (dotted quad notation, default router ID)" default:"-"`
 	RemovePrivateASNs      *bool     `yaml:"remove-private-asns" description:"Should private ASNs be removed from path before exporting?" default:"true"`
 	MPUnicast46            *bool     `yaml:"mp-unicast-46" description:"Should this peer be configured with multiprotocol IPv4 and IPv6 unicast?" default:"false"`
 	AllowLocalAS           *bool     `yaml:"allow-local-as" description:"Should routes originated by the local ASN be accepted?" default:"false"`
@@ -145,6 +146,7 @@ type Peer struct {
 	ImportCommunities    *[]string `yaml:"add-on-import" description:"List of communities to add to all imported routes" default:"-"`
 	ExportCommunities    *[]string `yaml:"add-on-export" description:"List of communities to add to all exported routes" default:"-"`
 	AnnounceCommunities  *[]string `yaml:"announce" description:"Announce all routes matching these communities to the peer" default:"-"`
+	AnnounceClasses      *[]string `yaml:"announce-classes" description:"Announce all routes imported from peers of these types (from informational-communities peer-types) to the peer" default:"-"`
 	RemoveCommunities    *[]string `yaml:"remove-communities" description:"List of communities to remove before from routes announced by this peer" default:"-"`
 	RemoveAllCommunities *int      `yaml:"remove-all-communities" description:"Remove all standard and large communities beginning with this value" default:"-"`
 
@@ -210,11 +212,13 @@ type Peer struct {
 
 	Role         *string `yaml:"role" description:"RFC 9234 Local BGP role" default:"-"`
 	RequireRoles *bool   `yaml:"require-roles" description:"Require RFC 9234 BGP roles" default:"false"`
+	Relationship *string `yaml:"relationship" description:"Peer relationship (customer, peer, upstream, rs, internal) used to set valley-free export defaults and the BGP role" default:"-"`
 
 	// Export options
 	AnnounceDefault    *bool `yaml:"announce-default" description:"Should a default route be exported to this peer?" default:"false"`
 	AnnounceOriginated *bool `yaml:"announce-originated" description:"Should locally originated routes be announced to this peer?" default:"true"`
 	AnnounceAll        *bool `yaml:"announce-all" description:"Should all routes be exported to this peer?" default:"false"`
+	Flowspec           *bool `yaml:"flowspec" description:"Should flowspec rules be exported to this peer?" default:"false"`
 
 	// Custom daemon configuration
 	SessionGlobal *string `yaml:"session-global" description:"Configuration to add to each session before any defined BGP protocols" default:"-"`
@@ -228,20 +232,105 @@ type Peer struct {
 	// Optimizer
 	OptimizerProbeSources *[]string `yaml:"probe-sources" description:"Optimizer probe source addresses" default:"-"`
 	OptimizeInbound       *bool     `yaml:"optimize-inbound" description:"Should the optimizer modify inbound policy?" default:"false"`
+	SteerOutbound         *bool     `yaml:"steer-outbound" description:"Should the optimizer steer destination prefixes to this peer when it performs best?" default:"false"`
+
+	ProtocolName                *string            `yaml:"-" description:"-" default:"-"`
+	Protocols                   *[]string          `yaml:"-" description:"-" default:"-"`
+	PrefixSet4                  *[]string          `yaml:"-" description:"-" default:"-"`
+	PrefixSet6                  *[]string          `yaml:"-" description:"-" default:"-"`
+	ImportStandardCommunities   *[]string          `yaml:"-" description:"-" default:"-"`
+	ImportLargeCommunities      *[]string          `yaml:"-" description:"-" default:"-"`
+	ExportStandardCommunities   *[]string          `yaml:"-" description:"-" default:"-"`
+	ExportLargeCommunities      *[]string          `yaml:"-" description:"-" default:"-"`
+	AnnounceStandardCommunities *[]string          `yaml:"-" description:"-" default:"-"`
+	AnnounceLargeCommunities    *[]string          `yaml:"-" description:"-" default:"-"`
+	RemoveStandardCommunities   *[]string          `yaml:"-" description:"-" default:"-"`
+	RemoveLargeCommunities      *[]string          `yaml:"-" description:"-" default:"-"`
+	BooleanOptions              *[]string          `yaml:"-" description:"-" default:"-"`
+	ExportActions               *[]ExportAction    `yaml:"-" description:"-" default:"-"`
+	Blackholes4                 *[]string          `yaml:"-" description:"-" default:"-"`
+	Blackholes6                 *[]string          `yaml:"-" description:"-" default:"-"`
+	NoAnnouncePrefixes4         *[]string          `yaml:"-" description:"-" default:"-"`
+	NoAnnouncePrefixes6         *[]string          `yaml:"-" description:"-" default:"-"`
+	RouteServerPolicy           *RouteServerPolicy `yaml:"-" description:"-" default:"-"`
+}
+
+// ActionCommunity stores an action to take when exporting routes tagged with a community
+type ActionCommunity struct {
+	Description string   `yaml:"description" description:"Description of the action for generated customer documentation"`
+	Prepend     uint     `yaml:"prepend" description:"Number of times to prepend the local ASN" default:"0"`
+	NoExport    bool     `yaml:"no-export" description:"Don't export the route" default:"false"`
+	LocalPref   uint     `yaml:"local-pref" description:"Local pref to set when exporting the route to iBGP peers (0 to leave unchanged)" default:"0"`
+	Peers       []string `yaml:"peers" description:"Names of peers to apply the action to (all peers if peers, tags and asns are empty)"`
+	Tags        []string `yaml:"tags" description:"Tags of peers to apply the action to"`
+	ASNs        []uint32 `yaml:"asns" description:"ASNs of peers to apply the action to"`
+}
+
+// ExportAction is an action community resolved for a single peer
+type ExportAction struct {
+	Community string
+	Large     bool
+	Prepend   *int
+	NoExport  bool
+	LocalPref uint
+
+	// Relationship community of routes learned from customers, the action only applies to routes tagged with it if set
+	CustomerCommunity string
+}
+
+// RouteServerPolicy stores the route server action communities of a route server client that can't be expressed as export actions
+type RouteServerPolicy struct {
+	AnnounceNone   []ExportAction
+	Announce       []ExportAction
+	RemoveStandard []string
+	RemoveLarge    []string
+}
 
-	ProtocolName                *string   `yaml:"-" description:"-" default:"-"`
-	Protocols                   *[]string `yaml:"-" description:"-" default:"-"`
-	PrefixSet4                  *[]string `yaml:"-" description:"-" default:"-"`
-	PrefixSet6                  *[]string `yaml:"-" description:"-" default:"-"`
-	ImportStandardCommunities   *[]string `yaml:"-" description:"-" default:"-"`
-	ImportLargeCommunities      *[]string `yaml:"-" description:"-" default:"-"`
-	ExportStandardCommunities   *[]string `yaml:"-" description:"-" default:"-"`
-	ExportLargeCommunities      *[]string `yaml:"-" description:"-" default:"-"`
-	AnnounceStandardCommunities *[]string `yaml:"-" description:"-" default:"-"`
-	AnnounceLargeCommunities    *[]string `yaml:"-" description:"-" default:"-"`
-	RemoveStandardCommunities   *[]string `yaml:"-" description:"-" default:"-"`
-	RemoveLargeCommunities      *[]string `yaml:"-" description:"-" default:"-"`
-	BooleanOptions              *[]string `yaml:"-" description:"-" default:"-"`
+// PrefixOptions stores announcement options of a locally originated prefix
+type PrefixOptions struct {
+	Communities    []string `yaml:"communities" description:"List of communities to add to the prefix when it's announced"`
+	Prepends       uint     `yaml:"prepends" description:"Number of times to prepend the local ASN when announcing the prefix" default:"0"`
+	AnnounceTo     []string `yaml:"announce-to" description:"Only announce the prefix to these peers (peer name, tag:name or asn:number)"`
+	DontAnnounceTo []string `yaml:"dont-announce-to" description:"Don't announce the prefix to these peers (peer name, tag:name or asn:number)"`
+	IfRoute        string   `yaml:"if-route" description:"Only announce the prefix while a unicast route to this IP address exists"`
+
+	StandardCommunities []string `yaml:"-" description:"-"`
+	LargeCommunities    []string `yaml:"-" description:"-"`
+	PrependCount        *int     `yaml:"-" description:"-"`
+}
+
+// HealthCheck stores a health check that controls the announcement of an anycast prefix
+type HealthCheck struct {
+	Type              string `yaml:"type" description:"Health check type (tcp, http, command)" validate:"required"`
+	Target            string `yaml:"target" description:"Address (host:port) to connect to for tcp, URL to request for http, or shell command to run for command checks" validate:"required"`
+	ExpectedStatus    int    `yaml:"expected-status" description:"HTTP status code of a healthy http check" default:"200"`
+	Interval          uint   `yaml:"interval" description:"Seconds between checks" default:"5"`
+	Timeout           uint   `yaml:"timeout" description:"Seconds before a check fails" default:"2"`
+	Rise              uint   `yaml:"rise" description:"Number of consecutive successful checks before announcing the prefix" default:"3"`
+	Fall              uint   `yaml:"fall" description:"Number of consecutive failed checks before withdrawing the prefix" default:"3"`
+	DampeningHalfLife uint   `yaml:"dampening-half-life" description:"Seconds for the flap penalty to decay by half" default:"300"`
+	DampeningSuppress uint   `yaml:"dampening-suppress" description:"Flap penalty (1000 per withdrawal) above which the prefix stays withdrawn" default:"3000"`
+	DampeningReuse    uint   `yaml:"dampening-reuse" description:"Flap penalty below which a suppressed prefix can be announced again" default:"750"`
+
+	ProtocolName string `yaml:"-" description:"-"`
+	Announced    bool   `yaml:"-" description:"-"`
+}
+
+// FlowspecRule stores a single flowspec rule
+type FlowspecRule struct {
+	Destination      string   `yaml:"destination" description:"Destination prefix to match" validate:"required"`
+	Source           string   `yaml:"source" description:"Source prefix to match"`
+	Protocol         string   `yaml:"protocol" description:"IP protocol to match (tcp, udp, icmp, icmpv6, gre, esp or protocol number)"`
+	DestinationPorts []string `yaml:"destination-ports" description:"List of destination ports or port ranges to match (e.g. 53 or 1024-2048)"`
+	SourcePorts      []string `yaml:"source-ports" description:"List of source ports or port ranges to match"`
+	PacketLengths    []string `yaml:"packet-lengths" description:"List of packet lengths or length ranges to match"`
+	Action           string   `yaml:"action" description:"Action to take on matching traffic (discard, rate-limit, redirect)" validate:"required"`
+	RateLimit        float32  `yaml:"rate-limit" description:"Rate limit in bytes per second for the rate-limit action" default:"0"`
+	Redirect         string   `yaml:"redirect" description:"Route target (ASN:value) of the VRF to redirect traffic to for the redirect action"`
+
+	AF         string `yaml:"-" json:"-" description:"-"`
+	Components string `yaml:"-" json:"-" description:"-"`
+	Community  string `yaml:"-" json:"-" description:"-"`
 }
 
 // VRRPInstance stores a single VRRP instance
@@ -273,6 +362,44 @@ type MRTInstance struct {
 	Table    *string `yaml:"table" description:"Routing table to read from" default:"-"`
 }
 
+// BMP stores BGP Monitoring Protocol options
+type BMP struct {
+	Station       string `yaml:"station" description:"IP address of the BMP monitoring station (BMP disabled if empty)"`
+	Port          uint   `yaml:"port" description:"TCP port of the BMP monitoring station" default:"1790"`
+	PrePolicy     bool   `yaml:"monitor-pre-policy" description:"Monitor received routes before import filters are applied" default:"true"`
+	PostPolicy    bool   `yaml:"monitor-post-policy" description:"Monitor received routes after import filters are applied" default:"false"`
+	TxBufferLimit uint   `yaml:"tx-buffer-limit" description:"Maximum size of the BMP transmit buffer in megabytes" default:"1024"`
+
+	Enabled bool `yaml:"-" description:"-"`
+}
+
+// InformationalCommunities stores options for tagging imported routes with their origin
+type InformationalCommunities struct {
+	Enable           bool              `yaml:"enable" description:"Add informational large communities to routes imported from external peers" default:"false"`
+	Site             uint32            `yaml:"site" description:"Site ID of this router (default router ID as an integer)" default:"0"`
+	PeerTypes        map[string]uint32 `yaml:"peer-types" description:"Map of peer tag to peer type ID (default transit: 1, ix: 2, customer: 3, private: 4)"`
+	PeerTypeFunction uint32            `yaml:"peer-type-function" description:"Large community function (second field) of the peer type community" default:"1"`
+	SiteFunction     uint32            `yaml:"site-function" description:"Large community function (second field) of the ingress site community" default:"2"`
+	PeerASNFunction  uint32            `yaml:"peer-asn-function" description:"Large community function (second field) of the ingress peer ASN community" default:"3"`
+}
+
+// Router stores a router in the iBGP inventory
+type Router struct {
+	Loopback4 string `yaml:"loopback4" description:"IPv4 loopback address to use for iBGP sessions"`
+	Loopback6 string `yaml:"loopback6" description:"IPv6 loopback address to use for iBGP sessions"`
+	Role      string `yaml:"role" description:"iBGP role (rr, client or full-mesh)" default:"full-mesh"`
+	ClusterID string `yaml:"cluster-id" description:"Route reflector cluster ID of an rr router (dotted quad notation, default router ID)"`
+
+	Overrides map[string]interface{} `yaml:"overrides" description:"Config options to override in this router's config when generating all routers"`
+}
+
+// RouteServer stores route server mode options
+type RouteServer struct {
+	Enable            bool `yaml:"enable" description:"Enable route server mode (external peers default to route server clients)" default:"false"`
+	ActionCommunities bool `yaml:"action-communities" description:"Interpret standard route server action communities in the export filters of route server clients" default:"true"`
+	Descriptions      bool `yaml:"descriptions" description:"Generate looking glass friendly session descriptions for route server clients (AS<asn> <description or peer name>)" default:"true"`
+}
+
 // Kernel stores options that relate to the OS kernel
 type Kernel struct {
 	Accept4         []string          `yaml:"accept4" description:"List of BIRD protocols to import into the IPv4 table"`
@@ -295,29 +422,67 @@ type Kernel struct {
 
 // ProbeResult stores a single probe result
 type ProbeResult struct {
-	Time  int64
-	Stats ping.Statistics
+	Time  int64           `json:"time"`
+	Stats ping.Statistics `json:"stats"`
+}
+
+// OptimizerState stores the optimizer's hysteresis state for a single peer
+type OptimizerState struct {
+	Degraded    bool  `json:"degraded"`
+	Since       int64 `json:"since"`
+	BadWindows  uint  `json:"bad-windows"`
+	GoodWindows uint  `json:"good-windows"`
 }
 
 // Optimizer stores route optimizer configuration
 type Optimizer struct {
-	Targets             []string `yaml:"targets" description:"List of probe targets"`
-	LatencyThreshold    uint     `yaml:"latency-threshold" description:"Maximum allowable latency in milliseconds" default:"100"`
+	Targets             []string `yaml:"targets" description:"List of probe targets (IP or hostname for ICMP, or icmp://host, tcp://host:port, http://host/path, https://host/path)"`
+	LatencyThreshold    uint     `yaml:"latency-threshold" description:"Maximum allowable average latency in milliseconds" default:"100"`
+	P50Threshold        uint     `yaml:"latency-p50-threshold" description:"Maximum allowable median latency in milliseconds (0 to disable)" default:"0"`
+	P95Threshold        uint     `yaml:"latency-p95-threshold" description:"Maximum allowable 95th percentile latency in milliseconds (0 to disable)" default:"0"`
+	P99Threshold        uint     `yaml:"latency-p99-threshold" description:"Maximum allowable 99th percentile latency in milliseconds (0 to disable)" default:"0"`
+	JitterThreshold     uint     `yaml:"jitter-threshold" description:"Maximum allowable jitter (standard deviation of latency) in milliseconds (0 to disable)" default:"0"`
+	Window              uint     `yaml:"window" description:"Number of seconds of probe results to compute metrics over (0 to use all cached results)" default:"0"`
 	PacketLossThreshold float64  `yaml:"packet-loss-threshold" description:"Maximum allowable packet loss (percent)" default:"0.5"`
 	LocalPrefModifier   uint     `yaml:"modifier" description:"Amount to lower local pref by for depreferred peers" default:"20"`
+	DegradeAfter        uint     `yaml:"degrade-after" description:"Number of consecutive probe runs exceeding a threshold before a peer is depreferred" validate:"min=1" default:"1"`
+	RestoreAfter        uint     `yaml:"restore-after" description:"Number of consecutive healthy probe runs before a depreferred peer's local pref is restored" validate:"min=1" default:"3"`
 
 	PingCount   int `yaml:"probe-count" description:"Number of pings to send in each run" default:"5"`
-	PingTimeout int `yaml:"probe-timeout" description:"Number of seconds to wait before considering the ICMP message unanswered" default:"1"`
+	PingTimeout int `yaml:"probe-timeout" description:"Number of seconds to wait before considering a probe unanswered" default:"1"`
 	Interval    int `yaml:"probe-interval" description:"Number of seconds wait between each optimizer run" default:"120"`
 	CacheSize   int `yaml:"cache-size" description:"Number of probe results to store per peer" default:"15"`
 
+	ProbeWorkers uint `yaml:"probe-workers" description:"Maximum number of concurrent probes" validate:"min=1" default:"8"`
+	ProbeJitter  uint `yaml:"probe-jitter" description:"Maximum random delay in milliseconds before sending each probe" default:"1000"`
+
 	ProbeUDPMode bool `yaml:"probe-udp" description:"Use UDP probe (else ICMP)" default:"false"`
 
-	AlertScript string `yaml:"alert-script" description:"Script to call on optimizer event"`
+	AlertScript     string `yaml:"alert-script" description:"Script to call on optimizer event"`
+	AlertScriptJSON bool   `yaml:"alert-script-json" description:"Pass alerts to the alert script as a JSON object on stdin instead of a message argument" default:"false"`
+	AlertWebhook    string `yaml:"alert-webhook" description:"URL to POST alerts to as JSON objects"`
+	AlertSyslog     bool   `yaml:"alert-syslog" description:"Send alerts to the local syslog daemon" default:"false"`
+	AlertRepeat     uint   `yaml:"alert-repeat" description:"Number of seconds before re-sending an alert that is still active (0 to only send when a threshold is first exceeded)" default:"0"`
 
 	ExitOnCacheFull bool `yaml:"exit-on-cache-full" description:"Exit optimizer on cache full" default:"false"`
 
-	Db map[string][]ProbeResult `yaml:"-" description:"-"`
+	StatusSocket string `yaml:"status-socket" description:"UNIX socket to serve optimizer status and metrics on (empty to disable)" default:"/var/run/pathvector/optimizer.sock"`
+	StatusListen string `yaml:"status-listen" description:"HTTP listen address to serve optimizer status and Prometheus metrics on, such as :9101 (empty to disable)"`
+
+	Persist     bool `yaml:"persist" description:"Store probe results in a database in the cache directory to keep them across restarts" default:"true"`
+	DbRetention uint `yaml:"db-retention" description:"Number of seconds to keep probe results in the probe database (0 to keep forever)" default:"604800"`
+
+	SteerPrefixes       map[string][]string `yaml:"steer-prefixes" description:"Map of destination prefix to probe targets in the prefix, used to steer outbound traffic to the best performing peer"`
+	SteerMaxPrefixes    uint                `yaml:"steer-max-prefixes" description:"Maximum number of destination prefixes to steer" default:"100"`
+	SteerModifier       uint                `yaml:"steer-modifier" description:"Amount to raise local pref by for steered prefixes learned from the best performing peer" default:"20"`
+	SteerMinProbes      int                 `yaml:"steer-min-probes" description:"Minimum number of probe runs towards a destination prefix for a peer to be compared for steering" default:"3"`
+	SteerMinImprovement uint                `yaml:"steer-min-improvement" description:"Minimum latency improvement in milliseconds of the best peer over the worst peer to steer a destination prefix, unless the best peer has less packet loss" default:"10"`
+
+	Db       map[string][]ProbeResult            `yaml:"-" description:"-"`
+	SteerDb  map[string]map[string][]ProbeResult `yaml:"-" description:"-"`
+	State    map[string]*OptimizerState          `yaml:"-" description:"-"`
+	Steering map[string]string                   `yaml:"-" description:"-"`
+	Alerts   map[string]int64                    `yaml:"-" description:"-"`
 }
 
 // Config stores the global configuration
@@ -325,7 +490,10 @@ type Config struct {
 	PeeringDBQueryTimeout uint   `yaml:"peeringdb-query-timeout" description:"PeeringDB query timeout in seconds" default:"10"`
 	PeeringDBAPIKey       string `yaml:"peeringdb-api-key" description:"PeeringDB API key"`
 	PeeringDBCache        bool   `yaml:"peeringdb-cache" description:"Cache PeeringDB results" default:"true"`
+	PeeringDBQueryWorkers uint   `yaml:"peeringdb-query-workers" description:"Maximum number of concurrent PeeringDB queries" validate:"min=1" default:"4"`
+	PeeringDBQueryRetries uint   `yaml:"peeringdb-query-retries" description:"Number of times to retry a PeeringDB query that was rate limited (HTTP 429) or failed with a server error (HTTP 5xx)" default:"3"`
 	IRRQueryTimeout       uint   `yaml:"irr-query-timeout" description:"IRR query timeout in seconds" default:"30"`
+	IRRQueryWorkers       uint   `yaml:"irr-query-workers" description:"Maximum number of concurrent IRR queries" validate:"min=1" default:"4"`
 	BIRDDirectory         string `yaml:"bird-directory" description:"Directory to store BIRD configs" default:"/etc/bird/"`
 	BIRDBinary            string `yaml:"bird-binary" description:"Path to BIRD binary" default:"/usr/sbin/bird"`
 	BIRDSocket            string `yaml:"bird-socket" description:"UNIX control socket for BIRD" default:"/run/bird/bird.ctl"`
@@ -336,6 +504,9 @@ type Config struct {
 	GlobalConfig          string `yaml:"global-config" description:"Global BIRD configuration" default:""`
 	PeeringDBURL          string `yaml:"peeringdb-url" description:"PeeringDB API URL, can be set to a local PeeringDB cache server" default:"https://peeringdb.com/api/"`
 
+	PeeringDBSnapshot       string `yaml:"peeringdb-snapshot" description:"File to resolve PeeringDB lookups from, written by pathvector peeringdb sync (disabled if empty)" default:""`
+	PeeringDBSnapshotMaxAge uint   `yaml:"peeringdb-snapshot-max-age" description:"Maximum age of the PeeringDB snapshot in seconds before a warning is shown" default:"86400"`
+
 	Blocklist      []string `yaml:"blocklist" description:"List of ASNs, prefixes, and IP addresses to block" default:""`
 	BlocklistURLs  []string `yaml:"blocklist-urls" description:"List of URLs to fetch blocklists from" default:""`
 	BlocklistFiles []string `yaml:"blocklist-files" description:"List of files to fetch blocklists from" default:""`
@@ -348,10 +519,14 @@ type Config struct {
 	ImportCommunities []string `yaml:"add-on-import" description:"List of communities to add to all imported routes" default:"-"`
 	ExportCommunities []string `yaml:"add-on-export" description:"List of communities to add to all exported routes" default:"-"`
 
-	Hostname string `yaml:"hostname" description:"Router hostname (default system hostname)" default:""`
+	Hostname     string             `yaml:"hostname" description:"Router hostname (default system hostname)" default:""`
+	Routers      map[string]*Router `yaml:"routers" description:"Map of hostname to router for generating iBGP sessions with the router matching hostname"`
+	IBGPTemplate string             `yaml:"ibgp-template" description:"Peer template to apply to iBGP sessions generated from routers"`
 
-	ASN      int      `yaml:"asn" description:"Autonomous System Number" validate:"required" default:"0"`
-	Prefixes []string `yaml:"prefixes" description:"List of prefixes to announce"`
+	ASN           int                       `yaml:"asn" description:"Autonomous System Number" validate:"required" default:"0"`
+	Prefixes      []string                  `yaml:"prefixes" description:"List of prefixes to announce"`
+	PrefixOptions map[string]*PrefixOptions `yaml:"prefix-options" description:"Map of prefix (from prefixes or anycast) to announcement options"`
+	Anycast       map[string]*HealthCheck   `yaml:"anycast" description:"Map of anycast prefix to the health check that controls its announcement"`
 
 	RouterID      string `yaml:"router-id" description:"Router ID (dotted quad notation)" validate:"required"`
 	IRRServer     string `yaml:"irr-server" description:"Internet routing registry server" default:"rr.ntt.net"`
@@ -377,20 +552,34 @@ type Config struct {
 
 	AuthorizedProviders map[uint32][]uint32 `yaml:"authorized-providers" description:"Map of origin ASN to authorized provider ASN list" default:"-"`
 
+	ActionCommunities              map[string]*ActionCommunity `yaml:"action-communities" description:"Map of community to action to take when exporting routes tagged with it (peer-asn in the community is replaced with the ASN of each peer)"`
+	ActionCommunitiesCustomersOnly bool                        `yaml:"action-communities-customers-only" description:"Only apply action communities to routes learned from peers with relationship customer" default:"false"`
+
+	RelationshipFunction uint32 `yaml:"relationship-function" description:"Large community function (second field) of the relationship community added to routes imported from peers with a relationship" default:"4"`
+
 	Peers         map[string]*Peer         `yaml:"peers" description:"BGP peer configuration"`
 	Templates     map[string]*Peer         `yaml:"templates" description:"BGP peer templates"`
 	VRRPInstances map[string]*VRRPInstance `yaml:"vrrp" description:"List of VRRP instances"`
 	BFDInstances  map[string]*BFDInstance  `yaml:"bfd" description:"BFD instances"`
 	MRTInstances  map[string]*MRTInstance  `yaml:"mrt" description:"MRT instances"`
+	Flowspec      map[string]*FlowspecRule `yaml:"flowspec" description:"Map of name to flowspec rule to announce to peers with flowspec enabled"`
 	Kernel        *Kernel                  `yaml:"kernel" description:"Kernel routing configuration options"`
-	Optimizer     *Optimizer               `yaml:"optimizer" description:"Route optimizer options"`
-	Plugins       map[string]string        `yaml:"plugins" description:"Plugin-specific configuration"`
+	BMP           *BMP                     `yaml:"bmp" description:"BGP Monitoring Protocol options"`
+
+	InformationalCommunities *InformationalCommunities `yaml:"informational-communities" description:"Informational community tagging options"`
+	RouteServer              *RouteServer              `yaml:"route-server" description:"Route server mode options"`
+	Optimizer                *Optimizer                `yaml:"optimizer" description:"Route optimizer options"`
+	Plugins                  map[string]string         `yaml:"plugins" description:"Plugin-specific configuration"`
 
 	RTRServerHost             string   `yaml:"-" description:"-"`
 	RTRServerPort             int      `yaml:"-" description:"-"`
 	Prefixes4                 []string `yaml:"-" description:"-"`
 	Prefixes6                 []string `yaml:"-" description:"-"`
 	QueryNVRS                 bool     `yaml:"-" description:"-"`
+	FlowspecEnabled           bool     `yaml:"-" description:"-"`
+	OptimizerEnabled          bool     `yaml:"-" description:"-"`
+	Blackholes4               []string `yaml:"-" description:"-"`
+	Blackholes6               []string `yaml:"-" description:"-"`
 	NVRSASNs                  []uint32 `yaml:"-" description:"-"`
 	OriginStandardCommunities []string `yaml:"-" description:"-"`
 	OriginLargeCommunities    []string `yaml:"-" description:"-"`
@@ -409,7 +598,14 @@ func (c *Config) Init() {
 	c.VRRPInstances = map[string]*VRRPInstance{}
 	c.BFDInstances = map[string]*BFDInstance{}
 	c.MRTInstances = map[string]*MRTInstance{}
+	c.Flowspec = map[string]*FlowspecRule{}
+	c.PrefixOptions = map[string]*PrefixOptions{}
+	c.Anycast = map[string]*HealthCheck{}
+	c.Routers = map[string]*Router{}
 	c.Kernel = &Kernel{}
+	c.BMP = &BMP{}
+	c.InformationalCommunities = &InformationalCommunities{}
+	c.RouteServer = &RouteServer{}
 	c.Optimizer = &Optimizer{}
 	c.Plugins = map[string]string{}
 
@@ -0,0 +1,216 @@
+package healthcheck
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/natesales/pathvector/pkg/bird"
+	"github.com/natesales/pathvector/pkg/config"
+)
+
+// StateFile is the name of the file in the cache directory storing whether each anycast prefix is announced
+const StateFile = "anycast-state.json"
+
+// Health check types
+const (
+	TypeTCP     = "tcp"
+	TypeHTTP    = "http"
+	TypeCommand = "command"
+)
+
+// flapPenalty is the penalty added to a prefix each time it's withdrawn
+const flapPenalty = 1000
+
+// LoadState reads the map of anycast prefix to announcement state from the cache directory
+func LoadState(cacheDirectory string) (map[string]bool, error) {
+	state := map[string]bool{}
+	contents, err := os.ReadFile(path.Join(cacheDirectory, StateFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(contents, &state); err != nil {
+		return nil, fmt.Errorf("anycast state JSON unmarshal: %s", err)
+	}
+	return state, nil
+}
+
+// saveState writes the map of anycast prefix to announcement state to the cache directory
+func saveState(cacheDirectory string, state map[string]bool) error {
+	j, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	//nolint:golint,gosec
+	return os.WriteFile(path.Join(cacheDirectory, StateFile), j, 0644)
+}
+
+// check runs a health check once and returns an error if it fails
+func check(hc *config.HealthCheck) error {
+	timeout := time.Duration(hc.Timeout) * time.Second
+	switch hc.Type {
+	case TypeTCP:
+		conn, err := net.DialTimeout("tcp", hc.Target, timeout)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	case TypeHTTP:
+		client := http.Client{Timeout: timeout}
+		resp, err := client.Get(hc.Target)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != hc.ExpectedStatus {
+			return fmt.Errorf("HTTP status %d, expected %d", resp.StatusCode, hc.ExpectedStatus)
+		}
+		return nil
+	case TypeCommand:
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		//nolint:gosec
+		return exec.CommandContext(ctx, "sh", "-c", hc.Target).Run()
+	default:
+		return fmt.Errorf("unknown health check type %s", hc.Type)
+	}
+}
+
+// tracker tracks the health and flap penalty of an anycast prefix
+type tracker struct {
+	healthy    bool
+	successes  uint
+	failures   uint
+	penalty    float64
+	suppressed bool
+	updated    time.Time
+}
+
+// update records a check result and returns true if the prefix should be announced. The prefix becomes healthy after
+// Rise consecutive successes and unhealthy after Fall consecutive failures, and every withdrawal adds to a penalty that
+// decays over time. Prefixes with a penalty above DampeningSuppress stay withdrawn until it decays below DampeningReuse.
+func (t *tracker) update(hc *config.HealthCheck, ok bool, now time.Time) bool {
+	if !t.updated.IsZero() && hc.DampeningHalfLife > 0 {
+		halfLives := now.Sub(t.updated).Seconds() / float64(hc.DampeningHalfLife)
+		t.penalty *= math.Pow(0.5, halfLives)
+	}
+	t.updated = now
+
+	if ok {
+		t.successes++
+		t.failures = 0
+		if !t.healthy && t.successes >= hc.Rise {
+			t.healthy = true
+		}
+	} else {
+		t.failures++
+		t.successes = 0
+		if t.healthy && t.failures >= hc.Fall {
+			t.healthy = false
+			t.penalty += flapPenalty
+		}
+	}
+
+	if t.penalty > float64(hc.DampeningSuppress) {
+		t.suppressed = true
+	} else if t.suppressed && t.penalty < float64(hc.DampeningReuse) {
+		t.suppressed = false
+	}
+	return t.healthy && !t.suppressed
+}
+
+// setProtocol enables or disables the static protocol of an anycast prefix
+func setProtocol(protocol string, announce bool, socket string) error {
+	command := "disable " + protocol
+	if announce {
+		command = "enable " + protocol
+	}
+	resp, _, err := bird.RunCommand(command, socket)
+	if err != nil {
+		return err
+	}
+	log.Debugf("BIRD response: %s", resp)
+	return nil
+}
+
+// Run starts health checking all anycast prefixes, announcing and withdrawing them through the BIRD socket
+func Run(c *config.Config, noConfigure bool) error {
+	if len(c.Anycast) == 0 {
+		return fmt.Errorf("no anycast prefixes configured")
+	}
+	if err := os.MkdirAll(c.CacheDirectory, os.FileMode(0755)); err != nil {
+		return err
+	}
+	state, err := LoadState(c.CacheDirectory)
+	if err != nil {
+		return fmt.Errorf("reading anycast state: %s", err)
+	}
+
+	prefixes := make([]string, 0, len(c.Anycast))
+	for prefix := range c.Anycast {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+
+	var lock sync.Mutex
+	setState := func(prefix string, announce bool) {
+		lock.Lock()
+		defer lock.Unlock()
+		state[prefix] = announce
+		if err := saveState(c.CacheDirectory, state); err != nil {
+			log.Warnf("[Healthcheck] Writing anycast state: %s", err)
+		}
+		if !noConfigure {
+			if err := setProtocol(c.Anycast[prefix].ProtocolName, announce, c.BIRDSocket); err != nil {
+				log.Warnf("[Healthcheck] Updating %s in BIRD: %s", prefix, err)
+			}
+		}
+	}
+
+	for _, prefix := range prefixes {
+		hc := c.Anycast[prefix]
+		announced := state[prefix]
+		t := &tracker{healthy: announced}
+
+		// Make sure BIRD matches the stored state
+		setState(prefix, announced)
+
+		go func(prefix string) {
+			ticker := time.NewTicker(time.Duration(hc.Interval) * time.Second)
+			for ; true; <-ticker.C {
+				err := check(hc)
+				if err != nil {
+					log.Debugf("[Healthcheck] %s check failed: %s", prefix, err)
+				}
+				announce := t.update(hc, err == nil, time.Now())
+				if announce != announced {
+					if announce {
+						log.Infof("[Healthcheck] %s is healthy, announcing", prefix)
+					} else if t.suppressed {
+						log.Warnf("[Healthcheck] %s is flapping (penalty %.0f), withdrawing", prefix, t.penalty)
+					} else {
+						log.Warnf("[Healthcheck] %s is unhealthy (%s), withdrawing", prefix, err)
+					}
+					announced = announce
+					setState(prefix, announce)
+				}
+			}
+		}(prefix)
+	}
+
+	select {}
+}
@@ -0,0 +1,127 @@
+package healthcheck
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/natesales/pathvector/pkg/config"
+)
+
+func testCheck() *config.HealthCheck {
+	return &config.HealthCheck{
+		Timeout:           1,
+		Rise:              2,
+		Fall:              2,
+		DampeningHalfLife: 60,
+		DampeningSuppress: 2500,
+		DampeningReuse:    1000,
+	}
+}
+
+func TestCheck(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	closedAddr := closed.Addr().String()
+	closed.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	for _, tc := range []struct {
+		name    string
+		hcType  string
+		target  string
+		healthy bool
+	}{
+		{"tcp up", TypeTCP, listener.Addr().String(), true},
+		{"tcp down", TypeTCP, closedAddr, false},
+		{"http up", TypeHTTP, server.URL + "/up", true},
+		{"http down", TypeHTTP, server.URL + "/down", false},
+		{"command up", TypeCommand, "exit 0", true},
+		{"command down", TypeCommand, "exit 1", false},
+		{"command timeout", TypeCommand, "sleep 5", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			hc := testCheck()
+			hc.Type = tc.hcType
+			hc.Target = tc.target
+			hc.ExpectedStatus = http.StatusOK
+			err := check(hc)
+			if tc.healthy {
+				assert.Nil(t, err)
+			} else {
+				assert.NotNil(t, err)
+			}
+		})
+	}
+}
+
+func TestTrackerRiseFall(t *testing.T) {
+	hc := testCheck()
+	tr := &tracker{}
+	now := time.Now()
+
+	assert.False(t, tr.update(hc, true, now))
+	assert.True(t, tr.update(hc, true, now))
+	assert.True(t, tr.update(hc, false, now))
+	assert.True(t, tr.update(hc, true, now)) // Failures must be consecutive
+	assert.True(t, tr.update(hc, false, now))
+	assert.False(t, tr.update(hc, false, now))
+	assert.Equal(t, float64(flapPenalty), tr.penalty)
+}
+
+func TestTrackerDampening(t *testing.T) {
+	hc := testCheck()
+	tr := &tracker{healthy: true}
+	now := time.Now()
+
+	// Flap three times to exceed the suppress threshold
+	for i := 0; i < 3; i++ {
+		tr.update(hc, false, now)
+		tr.update(hc, false, now)
+		tr.update(hc, true, now)
+		tr.update(hc, true, now)
+	}
+	assert.True(t, tr.suppressed)
+	assert.True(t, tr.healthy)
+	assert.False(t, tr.update(hc, true, now))
+
+	// Two half lives later the penalty has decayed to 750, below the reuse threshold
+	assert.True(t, tr.update(hc, true, now.Add(2*time.Minute)))
+	assert.False(t, tr.suppressed)
+	assert.InDelta(t, 750, tr.penalty, 0.01)
+}
+
+func TestState(t *testing.T) {
+	dir := t.TempDir()
+	state, err := LoadState(dir)
+	assert.Nil(t, err)
+	assert.Empty(t, state)
+
+	assert.Nil(t, saveState(dir, map[string]bool{"192.0.2.0/24": true, "2001:db8::/48": false}))
+	state, err = LoadState(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]bool{"192.0.2.0/24": true, "2001:db8::/48": false}, state)
+
+	assert.Nil(t, os.WriteFile(path.Join(dir, StateFile), []byte("invalid"), 0644))
+	_, err = LoadState(dir)
+	assert.NotNil(t, err)
+}
+
+func TestRunNoAnycast(t *testing.T) {
+	assert.ErrorContains(t, Run(&config.Config{}, true), "no anycast prefixes configured")
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os/exec"
 	"strings"
+	"sync"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -13,6 +14,79 @@ import (
 	"github.com/natesales/pathvector/pkg/config"
 )
 
+// bgpq4Binary is the bgpq4 executable used for IRR queries
+var bgpq4Binary = "bgpq4"
+
+// bgpq4Result stores the output of a single bgpq4 invocation
+type bgpq4Result struct {
+	wg     sync.WaitGroup
+	stdout []byte
+	err    error
+}
+
+var (
+	// workers limits the number of concurrent bgpq4 processes
+	workers     = make(chan struct{}, 4)
+	workersLock sync.Mutex
+
+	// results stores successful bgpq4 output by command line so identical queries from multiple peers are only run
+	// once. Failed queries are removed after concurrent identical queries receive the error, so they can be retried.
+	results     = map[string]*bgpq4Result{}
+	resultsLock sync.Mutex
+)
+
+// SetWorkers sets the maximum number of concurrent bgpq4 processes. Queries already running release their slot in the
+// previous pool.
+func SetWorkers(n uint) {
+	workersLock.Lock()
+	defer workersLock.Unlock()
+	workers = make(chan struct{}, n)
+}
+
+// acquireWorker waits for a slot in the worker pool and returns the pool to release it to
+func acquireWorker() chan struct{} {
+	workersLock.Lock()
+	pool := workers
+	workersLock.Unlock()
+	pool <- struct{}{}
+	return pool
+}
+
+// bgpq4 runs bgpq4 with the given arguments, returning the output of an identical earlier query if one exists
+func bgpq4(cmdArgs string, queryTimeout uint) ([]byte, error) {
+	resultsLock.Lock()
+	result, ok := results[cmdArgs]
+	if !ok {
+		result = &bgpq4Result{}
+		result.wg.Add(1)
+		results[cmdArgs] = result
+	}
+	resultsLock.Unlock()
+
+	if ok {
+		log.Debugf("Reusing bgpq4 %s", cmdArgs)
+		result.wg.Wait()
+		return result.stdout, result.err
+	}
+
+	pool := acquireWorker()
+	log.Debugf("Running bgpq4 %s", cmdArgs)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*time.Duration(queryTimeout))
+	//nolint:golint,gosec
+	cmd := exec.CommandContext(ctx, bgpq4Binary, strings.Split(cmdArgs, " ")...)
+	result.stdout, result.err = cmd.Output()
+	cancel()
+	<-pool
+	if result.err != nil {
+		resultsLock.Lock()
+		delete(results, cmdArgs)
+		resultsLock.Unlock()
+	}
+	result.wg.Done()
+
+	return result.stdout, result.err
+}
+
 // withSourceFilter returns the AS set or AS set with the IRR source replaced with the -S SOURCE syntax
 // AS34553 -> AS34553
 // RIPE::AS34553 -> -S RIPE AS34553
@@ -35,12 +109,7 @@ func PrefixSet(macro string, family uint8, irrServer string, queryTimeout uint,
 		if bgpqArgs != "" {
 			cmdArgs = bgpqArgs + " " + cmdArgs
 		}
-		log.Debugf("Running bgpq4 %s", cmdArgs)
-		ctx, cancel := context.WithTimeout(context.Background(), time.Second*time.Duration(queryTimeout))
-		defer cancel()
-		//nolint:golint,gosec
-		cmd := exec.CommandContext(ctx, "bgpq4", strings.Split(cmdArgs, " ")...)
-		stdout, err := cmd.Output()
+		stdout, err := bgpq4(cmdArgs, queryTimeout)
 		if err != nil {
 			return nil, err
 		}
@@ -67,12 +136,7 @@ func ASMembers(asSet string, irrServer string, queryTimeout uint, bgpqArgs strin
 	if bgpqArgs != "" {
 		cmdArgs = bgpqArgs + " " + cmdArgs
 	}
-	log.Debugf("Running bgpq4 %s", cmdArgs)
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*time.Duration(queryTimeout))
-	defer cancel()
-	//nolint:golint,gosec
-	cmd := exec.CommandContext(ctx, "bgpq4", strings.Split(cmdArgs, " ")...)
-	stdout, err := cmd.Output()
+	stdout, err := bgpq4(cmdArgs, queryTimeout)
 	if err != nil {
 		return nil, err
 	}
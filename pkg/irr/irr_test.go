@@ -1,7 +1,11 @@
 package irr
 
 import (
+	"os"
+	"path"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -85,3 +89,67 @@ func TestIRRASMembers(t *testing.T) {
 		assert.Equal(t, members[1], uint32(34553))
 	}
 }
+
+func TestIRRQueryDedup(t *testing.T) {
+	// Fake bgpq4 that records each invocation
+	dir := t.TempDir()
+	counter := path.Join(dir, "invocations")
+	script := path.Join(dir, "bgpq4")
+	//nolint:golint,gosec
+	assert.Nil(t, os.WriteFile(script, []byte(`#!/bin/sh
+echo "$@" >> `+counter+`
+sleep 0.1
+echo '{"NN": [65510, 65520]}'
+`), 0755))
+
+	oldBinary := bgpq4Binary
+	bgpq4Binary = script
+	SetWorkers(2)
+	defer func() {
+		bgpq4Binary = oldBinary
+		SetWorkers(4)
+	}()
+
+	wg := new(sync.WaitGroup)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			members, err := ASMembers("AS-DEDUP-TEST", "irr.example.com", irrQueryTimeout, "")
+			assert.Nil(t, err)
+			assert.Equal(t, []uint32{65510, 65520}, members)
+		}()
+	}
+	wg.Wait()
+
+	invocations, err := os.ReadFile(counter)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, strings.Count(string(invocations), "\n"))
+}
+
+func TestIRRQueryFailureNotCached(t *testing.T) {
+	// Fake bgpq4 that fails on the first invocation
+	dir := t.TempDir()
+	counter := path.Join(dir, "invocations")
+	script := path.Join(dir, "bgpq4")
+	//nolint:golint,gosec
+	assert.Nil(t, os.WriteFile(script, []byte(`#!/bin/sh
+if [ ! -f `+counter+` ]; then
+  touch `+counter+`
+  exit 1
+fi
+echo '{"NN": [65510]}'
+`), 0755))
+
+	oldBinary := bgpq4Binary
+	bgpq4Binary = script
+	defer func() {
+		bgpq4Binary = oldBinary
+	}()
+
+	_, err := ASMembers("AS-FAILURE-TEST", "irr.example.com", irrQueryTimeout, "")
+	assert.NotNil(t, err)
+	members, err := ASMembers("AS-FAILURE-TEST", "irr.example.com", irrQueryTimeout, "")
+	assert.Nil(t, err)
+	assert.Equal(t, []uint32{65510}, members)
+}
@@ -0,0 +1,137 @@
+package optimizer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/syslog"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/natesales/pathvector/pkg/config"
+)
+
+// Alert actions
+const (
+	ActionNone        = "none"
+	ActionDepreferred = "depreferred"
+)
+
+// alertTimeout is the maximum time to wait for an alert webhook or script
+const alertTimeout = 10 * time.Second
+
+// Alert is a threshold violation of a single peer metric
+type Alert struct {
+	Time      string  `json:"time"`
+	Peer      string  `json:"peer"`
+	ASN       int     `json:"asn"`
+	Metric    string  `json:"metric"`
+	Value     float64 `json:"value"`
+	Threshold float64 `json:"threshold"`
+	Unit      string  `json:"unit"`
+	Action    string  `json:"action"`
+	Message   string  `json:"message"`
+}
+
+// dedupAlerts returns the alerts of a peer that haven't already been sent, or were last sent more than o.AlertRepeat
+// seconds ago, and forgets previously sent alerts of the peer that are no longer active
+func dedupAlerts(o *config.Optimizer, peer string, alerts []Alert, now time.Time) []Alert {
+	if o.Alerts == nil {
+		o.Alerts = map[string]int64{}
+	}
+
+	var out []Alert
+	active := map[string]bool{}
+	for _, alert := range alerts {
+		key := peer + Delimiter + alert.Metric
+		active[key] = true
+		if lastSent, found := o.Alerts[key]; found {
+			if o.AlertRepeat == 0 || now.Sub(time.Unix(0, lastSent)) < time.Duration(o.AlertRepeat)*time.Second {
+				continue
+			}
+		}
+		o.Alerts[key] = now.UnixNano()
+		out = append(out, alert)
+	}
+
+	// Clear resolved alerts so they're sent again if the threshold is exceeded later
+	for key := range o.Alerts {
+		if strings.HasPrefix(key, peer+Delimiter) && !active[key] {
+			delete(o.Alerts, key)
+		}
+	}
+
+	return out
+}
+
+// sendAlert delivers an alert to the alert script, webhook and syslog
+func sendAlert(o *config.Optimizer, alert Alert) {
+	log.Infof("[Optimizer] Alert: %s (action: %s)", alert.Message, alert.Action)
+
+	payload, err := json.Marshal(alert)
+	if err != nil {
+		log.Warnf("[Optimizer] alert JSON marshal: %v", err)
+		return
+	}
+
+	if o.AlertScript != "" {
+		if err := runAlertScript(o.AlertScript, o.AlertScriptJSON, alert, payload); err != nil {
+			log.Warnf("[Optimizer] alert script: %v", err)
+		}
+	}
+
+	if o.AlertWebhook != "" {
+		if err := postAlert(o.AlertWebhook, payload); err != nil {
+			log.Warnf("[Optimizer] alert webhook: %v", err)
+		}
+	}
+
+	if o.AlertSyslog {
+		w, err := syslog.New(syslog.LOG_WARNING|syslog.LOG_DAEMON, "pathvector")
+		if err != nil {
+			log.Warnf("[Optimizer] alert syslog: %v", err)
+			return
+		}
+		if err := w.Warning(fmt.Sprintf("%s (action: %s)", alert.Message, alert.Action)); err != nil {
+			log.Warnf("[Optimizer] alert syslog: %v", err)
+		}
+		_ = w.Close()
+	}
+}
+
+// runAlertScript calls the alert script with the alert message as an argument, or with the JSON payload on stdin
+func runAlertScript(script string, jsonMode bool, alert Alert, payload []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), alertTimeout)
+	defer cancel()
+
+	//nolint:golint,gosec
+	cmd := exec.CommandContext(ctx, script)
+	if jsonMode {
+		cmd.Stdin = bytes.NewReader(payload)
+	} else {
+		cmd.Args = append(cmd.Args, alert.Message)
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// postAlert sends a JSON payload to a webhook URL
+func postAlert(url string, payload []byte) error {
+	client := http.Client{Timeout: alertTimeout}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package optimizer
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/natesales/pathvector/pkg/config"
+)
+
+func TestDedupAlerts(t *testing.T) {
+	now := time.Now()
+	peer := "65510" + Delimiter + "Example"
+	loss := Alert{Peer: "Example", ASN: 65510, Metric: "packet-loss"}
+	latency := Alert{Peer: "Example", ASN: 65510, Metric: "latency"}
+	o := &config.Optimizer{}
+
+	assert.Equal(t, []Alert{loss}, dedupAlerts(o, peer, []Alert{loss}, now))
+	assert.Nil(t, dedupAlerts(o, peer, []Alert{loss}, now.Add(time.Minute)))
+	assert.Equal(t, []Alert{latency}, dedupAlerts(o, peer, []Alert{loss, latency}, now.Add(2*time.Minute)))
+
+	// Other peers are tracked separately
+	assert.Len(t, dedupAlerts(o, "65520"+Delimiter+"Other", []Alert{loss}, now), 1)
+
+	// Resolved alerts are sent again
+	assert.Nil(t, dedupAlerts(o, peer, nil, now.Add(3*time.Minute)))
+	assert.Equal(t, []Alert{loss}, dedupAlerts(o, peer, []Alert{loss}, now.Add(4*time.Minute)))
+
+	// Active alerts are repeated after the repeat interval
+	o.AlertRepeat = 600
+	assert.Nil(t, dedupAlerts(o, peer, []Alert{loss}, now.Add(9*time.Minute)))
+	assert.Equal(t, []Alert{loss}, dedupAlerts(o, peer, []Alert{loss}, now.Add(15*time.Minute)))
+}
+
+func TestSendAlert(t *testing.T) {
+	alert := Alert{
+		Time:      "2026-01-02T03:04:05Z",
+		Peer:      "Example",
+		ASN:       65510,
+		Metric:    "packet-loss",
+		Value:     40,
+		Threshold: 0.5,
+		Unit:      "%",
+		Action:    ActionDepreferred,
+		Message:   "Peer AS65510 Example met or exceeded maximum allowable packet loss: 40.0 >= 0.5",
+	}
+
+	var received Alert
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		body, err := io.ReadAll(r.Body)
+		assert.Nil(t, err)
+		assert.Nil(t, json.Unmarshal(body, &received))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	script := path.Join(dir, "alert.sh")
+	//nolint:golint,gosec
+	assert.Nil(t, os.WriteFile(script, []byte("#!/bin/sh\ncat > "+path.Join(dir, "stdin")+"\necho \"$1\" > "+path.Join(dir, "args")+"\n"), 0755))
+
+	sendAlert(&config.Optimizer{AlertWebhook: server.URL, AlertScript: script, AlertScriptJSON: true}, alert)
+	assert.Equal(t, alert, received)
+	stdin, err := os.ReadFile(path.Join(dir, "stdin"))
+	assert.Nil(t, err)
+	var fromScript Alert
+	assert.Nil(t, json.Unmarshal(stdin, &fromScript))
+	assert.Equal(t, alert, fromScript)
+
+	sendAlert(&config.Optimizer{AlertScript: script}, alert)
+	args, err := os.ReadFile(path.Join(dir, "args"))
+	assert.Nil(t, err)
+	assert.Equal(t, alert.Message+"\n", string(args))
+}
@@ -0,0 +1,178 @@
+package optimizer
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/natesales/pathvector/pkg/config"
+)
+
+// DbFile is the name of the probe database file in the cache directory
+const DbFile = "optimizer.jsonl"
+
+// Record is a single probe result stored in the probe database
+type Record struct {
+	ASN    string `json:"asn"`
+	Peer   string `json:"peer"`
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Prefix string `json:"prefix,omitempty"`
+	config.ProbeResult
+}
+
+// DbPath returns the path of the probe database file
+func DbPath(cacheDirectory string) string {
+	return path.Join(cacheDirectory, DbFile)
+}
+
+// readDb reads all records from a probe database file, ignoring malformed lines
+func readDb(file string) ([]Record, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var r Record
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			log.Warnf("[Optimizer] Skipping malformed probe database entry: %s", err)
+			continue
+		}
+		records = append(records, r)
+	}
+	return records, scanner.Err()
+}
+
+// writeDb atomically replaces a probe database file with a list of records
+func writeDb(file string, records []Record) error {
+	tmpFile := file + ".tmp"
+	f, err := os.Create(tmpFile)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, r := range records {
+		j, err := json.Marshal(r)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		if _, err := w.Write(append(j, '\n')); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, file)
+}
+
+// appendDb appends a record to a probe database file
+func appendDb(file string, r Record) error {
+	j, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	//nolint:golint,gosec
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(j, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// compactDb removes records older than the retention period from a probe database file and returns the remaining records
+func compactDb(file string, retention time.Duration) ([]Record, error) {
+	records, err := readDb(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading probe database: %s", err)
+	}
+	if retention == 0 {
+		return records, nil
+	}
+
+	cutoff := time.Now().Add(-retention).UnixNano()
+	var kept []Record
+	for _, r := range records {
+		if r.Time >= cutoff {
+			kept = append(kept, r)
+		}
+	}
+	if len(kept) != len(records) {
+		log.Debugf("[Optimizer] Removing %d expired probe results from %s", len(records)-len(kept), file)
+		if err := writeDb(file, kept); err != nil {
+			return nil, fmt.Errorf("compacting probe database: %s", err)
+		}
+	}
+	return kept, nil
+}
+
+// loadDb populates the in-memory probe cache with the most recent results from the probe database
+func loadDb(o *config.Optimizer, records []Record) {
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Time < records[j].Time
+	})
+	for _, r := range records {
+		peer := r.ASN + Delimiter + r.Peer
+		if r.Prefix != "" {
+			if _, found := o.SteerPrefixes[r.Prefix]; found {
+				storeSteerResult(o, r.Prefix, peer, r.ProbeResult)
+			}
+			continue
+		}
+		o.Db[peer] = append(o.Db[peer], r.ProbeResult)
+		if len(o.Db[peer]) > o.CacheSize {
+			o.Db[peer] = o.Db[peer][1:]
+		}
+	}
+}
+
+// History returns all records in a probe database since a given time, optionally filtered by peer name or ASN
+func History(file string, since time.Time, peer string) ([]Record, error) {
+	records, err := readDb(file)
+	if err != nil {
+		return nil, err
+	}
+	var out []Record
+	for _, r := range records {
+		if r.Time < since.UnixNano() {
+			continue
+		}
+		if peer != "" && r.Peer != peer && r.ASN != strings.TrimPrefix(strings.ToUpper(peer), "AS") {
+			continue
+		}
+		out = append(out, r)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].Time < out[j].Time
+	})
+	return out, nil
+}
@@ -0,0 +1,143 @@
+package optimizer
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/natesales/pathvector/pkg/config"
+)
+
+// Metrics stores latency and packet loss metrics of a peer over a window of probe results
+type Metrics struct {
+	Probes     int
+	Latency    time.Duration
+	P50        time.Duration
+	P95        time.Duration
+	P99        time.Duration
+	Jitter     time.Duration
+	PacketLoss float64
+}
+
+// percentile returns the nearest-rank percentile of a sorted list of durations
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// computePeerMetrics computes metrics over all probe results newer than the window, or all results if window is zero.
+// Returns nil if there are no probe results in the window.
+func computePeerMetrics(results []config.ProbeResult, window time.Duration, now time.Time) *Metrics {
+	var (
+		samples      []time.Duration
+		sent, recv   int
+		probes       int
+		lossFallback float64
+	)
+	for _, result := range results {
+		if window > 0 && result.Time < now.Add(-window).UnixNano() {
+			continue
+		}
+		probes++
+		sent += result.Stats.PacketsSent
+		recv += result.Stats.PacketsRecv
+		lossFallback += result.Stats.PacketLoss
+
+		if len(result.Stats.Rtts) > 0 {
+			samples = append(samples, result.Stats.Rtts...)
+		} else if result.Stats.PacketsRecv > 0 || result.Stats.AvgRtt > 0 {
+			// Results without individual RTTs only contribute their average
+			samples = append(samples, result.Stats.AvgRtt)
+		}
+	}
+	if probes == 0 {
+		return nil
+	}
+
+	m := &Metrics{Probes: probes}
+	if sent > 0 {
+		m.PacketLoss = float64(sent-recv) / float64(sent) * 100
+	} else {
+		m.PacketLoss = lossFallback / float64(probes)
+	}
+
+	if len(samples) > 0 {
+		sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+		var total time.Duration
+		for _, sample := range samples {
+			total += sample
+		}
+		m.Latency = total / time.Duration(len(samples))
+		m.P50 = percentile(samples, 50)
+		m.P95 = percentile(samples, 95)
+		m.P99 = percentile(samples, 99)
+
+		var sumSquares float64
+		for _, sample := range samples {
+			sumSquares += math.Pow(float64(sample-m.Latency), 2)
+		}
+		m.Jitter = time.Duration(math.Sqrt(sumSquares / float64(len(samples))))
+	}
+
+	return m
+}
+
+// thresholdAlerts returns an alert for every threshold a peer's metrics meet or exceed
+func thresholdAlerts(o *config.Optimizer, peerASN string, peerName string, m *Metrics) []Alert {
+	asn, _ := strconv.Atoi(peerASN)
+	var alerts []Alert
+	if m.PacketLoss >= o.PacketLossThreshold {
+		alerts = append(alerts, Alert{
+			Peer:      peerName,
+			ASN:       asn,
+			Metric:    "packet-loss",
+			Value:     m.PacketLoss,
+			Threshold: o.PacketLossThreshold,
+			Unit:      "%",
+			Message: fmt.Sprintf("Peer AS%s %s met or exceeded maximum allowable packet loss: %.1f >= %.1f",
+				peerASN, peerName, m.PacketLoss, o.PacketLossThreshold,
+			),
+		})
+	}
+
+	for _, threshold := range []struct {
+		metric    string
+		name      string
+		value     time.Duration
+		threshold uint
+	}{
+		{"latency", "latency", m.Latency, o.LatencyThreshold},
+		{"latency-p50", "p50 latency", m.P50, o.P50Threshold},
+		{"latency-p95", "p95 latency", m.P95, o.P95Threshold},
+		{"latency-p99", "p99 latency", m.P99, o.P99Threshold},
+		{"jitter", "jitter", m.Jitter, o.JitterThreshold},
+	} {
+		if threshold.threshold == 0 {
+			continue
+		}
+		limit := time.Duration(threshold.threshold) * time.Millisecond
+		if threshold.value >= limit {
+			alerts = append(alerts, Alert{
+				Peer:      peerName,
+				ASN:       asn,
+				Metric:    threshold.metric,
+				Value:     float64(threshold.value) / float64(time.Millisecond),
+				Threshold: float64(threshold.threshold),
+				Unit:      "ms",
+				Message: fmt.Sprintf("Peer AS%s %s met or exceeded maximum allowable %s: %v >= %v",
+					peerASN, peerName, threshold.name, threshold.value, limit,
+				),
+			})
+		}
+	}
+
+	return alerts
+}
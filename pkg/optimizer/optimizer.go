@@ -2,30 +2,24 @@ package optimizer
 
 import (
 	"fmt"
+	"math/rand"
 	"net"
 	"os"
-	"os/exec"
 	"path"
-	"regexp"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/go-ping/ping"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/natesales/pathvector/pkg/bird"
 	"github.com/natesales/pathvector/pkg/config"
-	"github.com/natesales/pathvector/pkg/util"
 )
 
 // Delimiter is an arbitrary delimiter used to split ASN from peerName
 const Delimiter = "####"
 
-type peerAvg struct {
-	Latency    time.Duration
-	PacketLoss float64
-}
-
 // parsePeerDelimiter parses a ASN/name string and returns the ASN and name
 func parsePeerDelimiter(i string) (string, string) {
 	parts := strings.Split(i, Delimiter)
@@ -40,188 +34,346 @@ func sameAddressFamily(a string, b string) bool {
 	return (a4 && b4) || (!a4 && !b4)
 }
 
-// sendPing sends a probe ping to a specified target
-func sendPing(source string, target string, count int, timeout int, udp bool) (*ping.Statistics, error) {
-	pinger, err := ping.NewPinger(target)
+// probeFamilyMatches returns if a source address can be used to probe a target host. Hostnames are resolved in the source's address family.
+func probeFamilyMatches(source string, host string) bool {
+	if net.ParseIP(host) == nil {
+		return true
+	}
+	return sameAddressFamily(source, host)
+}
+
+// StartProbe starts the probe scheduler to send probes to all configured targets and logs the results. reload is called
+// to load the current config before writing the optimizer include file, so peers added since the optimizer started are
+// included.
+func StartProbe(o *config.Optimizer, sourceMap map[string][]string, global *config.Config, reload func() (*config.Config, error), noConfigure bool, dryRun bool) error {
+	// Initialize Db map
+	if o.Db == nil {
+		o.Db = map[string][]config.ProbeResult{} // peerName to list of probe results
+	}
+
+	// Load degraded peer state
+	state, err := LoadState(global.CacheDirectory)
 	if err != nil {
-		return &ping.Statistics{}, err
+		return fmt.Errorf("reading optimizer state: %s", err)
 	}
+	o.State = state
 
-	// Set pinger options
-	pinger.Count = count
-	pinger.Timeout = time.Duration(timeout) * time.Second
-	pinger.Source = source
-	pinger.SetPrivileged(!udp)
+	// Load steered destination prefixes
+	if err := validateSteerPrefixes(o.SteerPrefixes); err != nil {
+		return err
+	}
+	if o.SteerDb == nil {
+		o.SteerDb = map[string]map[string][]config.ProbeResult{} // prefix to peerName to list of probe results
+	}
+	steering, err := LoadSteering(global.CacheDirectory)
+	if err != nil {
+		return fmt.Errorf("reading optimizer steering: %s", err)
+	}
+	o.Steering = steering
 
-	// Run the ping
-	if err = pinger.Run(); err != nil {
-		return &ping.Statistics{}, fmt.Errorf("ping: %s", err)
+	// Load previous probe results
+	dbFile := DbPath(global.CacheDirectory)
+	retention := time.Duration(o.DbRetention) * time.Second
+	var lastCompaction time.Time
+	if o.Persist {
+		records, err := compactDb(dbFile, retention)
+		if err != nil {
+			return err
+		}
+		loadDb(o, records)
+		lastCompaction = time.Now()
+		log.Infof("[Optimizer] Loaded %d probe results from %s", len(records), dbFile)
 	}
 
-	return pinger.Statistics(), nil // nil error
-}
+	// Parse probe targets
+	probers := map[string]Prober{}
+	targets := append([]string{}, o.Targets...)
+	for _, prefixTargets := range o.SteerPrefixes {
+		targets = append(targets, prefixTargets...)
+	}
+	for _, target := range targets {
+		prober, err := NewProber(target, o.ProbeUDPMode)
+		if err != nil {
+			return err
+		}
+		probers[target] = prober
+	}
 
-// StartProbe starts the probe scheduler to send probes to all configured targets and logs the results
-func StartProbe(o *config.Optimizer, sourceMap map[string][]string, global *config.Config, noConfigure bool, dryRun bool) error {
-	// Initialize Db map
-	if o.Db == nil {
-		o.Db = map[string][]config.ProbeResult{} // peerName to list of probe results
+	// Find peers to steer destination prefixes to
+	var steerPeers []string
+	for peer := range sourceMap {
+		_, peerName := parsePeerDelimiter(peer)
+		if peerData := global.Peers[peerName]; peerData != nil && peerData.SteerOutbound != nil && *peerData.SteerOutbound {
+			steerPeers = append(steerPeers, peer)
+		}
+	}
+	if len(o.SteerPrefixes) > 0 && len(steerPeers) < 2 {
+		log.Warnf("[Optimizer] Prefix steering needs at least two peers with steer-outbound and probe sources, found %d", len(steerPeers))
+	}
+
+	if err := ServeStatus(o); err != nil {
+		return err
 	}
 
+	interval := time.Duration(o.Interval) * time.Second
 	for {
-		// Loop over every source/target pair
-		for peerName, sources := range sourceMap {
-			for _, source := range sources {
-				for _, target := range o.Targets {
-					if sameAddressFamily(source, target) {
-						log.Debugf("[Optimizer] Sending %d ICMP probes src %s dst %s", o.PingCount, source, target)
-						stats, err := sendPing(source, target, o.PingCount, o.PingTimeout, o.ProbeUDPMode)
-						if err != nil {
-							return err
-						}
-
-						// Check for nil Db entries
-						if o.Db[peerName] == nil {
-							o.Db[peerName] = []config.ProbeResult{}
-						}
-
-						result := config.ProbeResult{
-							Time:  time.Now().UnixNano(),
-							Stats: *stats,
-						}
-
-						log.Debugf("[Optimizer] cache usage: %d/%d", len(o.Db[peerName]), o.CacheSize)
-
-						if len(o.Db[peerName]) < o.CacheSize {
-							// If the array is not full to CacheSize, append the result
-							o.Db[peerName] = append(o.Db[peerName], result)
-						} else {
-							// If the array is full to probeCacheSize...
-							if o.ExitOnCacheFull {
-								return nil
-							}
-							// Chop off the first element and append the result
-							o.Db[peerName] = append(o.Db[peerName][1:], result)
-						}
-					}
-				}
+		roundStart := time.Now()
+		if probeRound(o, sourceMap, steerPeers, probers, dbFile) {
+			return nil
+		}
+		roundDuration := time.Since(roundStart)
+		if roundDuration > interval {
+			log.Warnf("[Optimizer] Probe round took %s, exceeding the probe interval of %s. Consider increasing probe-workers or probe-interval.", roundDuration.Round(time.Millisecond), interval)
+		} else {
+			log.Debugf("[Optimizer] Probe round took %s of %s interval", roundDuration.Round(time.Millisecond), interval)
+		}
+
+		// Remove expired probe results from the database
+		if o.Persist && time.Since(lastCompaction) > time.Hour {
+			if _, err := compactDb(dbFile, retention); err != nil {
+				log.Warn(err)
 			}
+			lastCompaction = time.Now()
 		}
 
 		// Compute averages
-		computeMetrics(o, global, noConfigure, dryRun)
+		computeMetrics(o, global, reload, noConfigure, dryRun)
 
-		// Sleep before sending the next probe
-		waitInterval := time.Duration(o.Interval) * time.Second
-		log.Debugf("[Optimizer] Waiting %s until next probe run", waitInterval)
-		time.Sleep(waitInterval)
+		// Sleep until the next probe round is due
+		waitInterval := interval - time.Since(roundStart)
+		if waitInterval > 0 {
+			log.Debugf("[Optimizer] Waiting %s until next probe run", waitInterval.Round(time.Millisecond))
+			time.Sleep(waitInterval)
+		}
 	}
 }
 
-// computeMetrics calculates average latency and packet loss
-func computeMetrics(o *config.Optimizer, global *config.Config, noConfigure bool, dryRun bool) {
-	p := map[string]*peerAvg{}
-	for peer := range o.Db {
-		if p[peer] == nil {
-			p[peer] = &peerAvg{Latency: 0, PacketLoss: 0}
+// probeJob is a single source/target pair to probe for a peer, and the destination prefix of the target if it is a steering probe
+type probeJob struct {
+	peer   string
+	source string
+	target string
+	prefix string
+}
+
+// probeRound probes every source/target pair concurrently, with at most o.ProbeWorkers probes in flight,
+// and returns true if a peer's probe cache is full and the optimizer is configured to exit on a full cache.
+// Targets in steered destination prefixes are probed from the sources of every peer in steerPeers.
+// Probes that fail with an error, such as from an unconfigured source address, are skipped rather than counted as lost.
+func probeRound(o *config.Optimizer, sourceMap map[string][]string, steerPeers []string, probers map[string]Prober, dbFile string) bool {
+	var jobs []probeJob
+	var peers []string
+	for peer := range sourceMap {
+		peers = append(peers, peer)
+	}
+	sort.Strings(peers)
+	for _, peer := range peers {
+		for _, source := range sourceMap[peer] {
+			for _, target := range o.Targets {
+				if probeFamilyMatches(source, probers[target].Host()) {
+					jobs = append(jobs, probeJob{peer, source, target, ""})
+				}
+			}
 		}
-		for result := range o.Db[peer] {
-			p[peer].PacketLoss += o.Db[peer][result].Stats.PacketLoss
-			p[peer].Latency += o.Db[peer][result].Stats.AvgRtt
+	}
+
+	var prefixes []string
+	for prefix := range o.SteerPrefixes {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	sort.Strings(steerPeers)
+	for _, prefix := range prefixes {
+		for _, peer := range steerPeers {
+			for _, source := range sourceMap[peer] {
+				for _, target := range o.SteerPrefixes[prefix] {
+					if probeFamilyMatches(source, probers[target].Host()) {
+						jobs = append(jobs, probeJob{peer, source, target, prefix})
+					}
+				}
+			}
 		}
+	}
 
-		// Calculate average latency and packet loss
-		totalProbes := float64(len(o.Db[peer]))
-		p[peer].PacketLoss = p[peer].PacketLoss / totalProbes
-		p[peer].Latency = p[peer].Latency / time.Duration(totalProbes)
+	var (
+		wg        sync.WaitGroup
+		lock      sync.Mutex
+		cacheFull bool
+		workers   = make(chan struct{}, o.ProbeWorkers)
+	)
+	for _, job := range jobs {
+		wg.Add(1)
+		go func(job probeJob) {
+			defer wg.Done()
 
-		// Check thresholds to apply optimizations
-		var alerts []string
+			// Spread probes out so targets don't receive synchronized bursts, without holding a worker while waiting
+			if o.ProbeJitter > 0 {
+				//nolint:golint,gosec
+				time.Sleep(time.Duration(rand.Int63n(int64(o.ProbeJitter) * int64(time.Millisecond))))
+			}
+			workers <- struct{}{}
+			defer func() { <-workers }()
+
+			log.Debugf("[Optimizer] Sending %d probes src %s dst %s", o.PingCount, job.source, job.target)
+			stats, err := probers[job.target].Probe(job.source, o.PingCount, time.Duration(o.PingTimeout)*time.Second)
+			if err != nil {
+				log.Warnf("[Optimizer] Probing %s from %s, skipping: %v", job.target, job.source, err)
+				return
+			}
+
+			lock.Lock()
+			defer lock.Unlock()
+
+			result := config.ProbeResult{
+				Time:  time.Now().UnixNano(),
+				Stats: *stats,
+			}
+
+			if o.Persist {
+				peerASN, peerName := parsePeerDelimiter(job.peer)
+				if err := appendDb(dbFile, Record{
+					ASN:         peerASN,
+					Peer:        peerName,
+					Source:      job.source,
+					Target:      job.target,
+					Prefix:      job.prefix,
+					ProbeResult: result,
+				}); err != nil {
+					log.Warnf("[Optimizer] Writing probe result to database: %s", err)
+				}
+			}
+
+			if job.prefix != "" {
+				storeSteerResult(o, job.prefix, job.peer, result)
+				return
+			}
+
+			log.Debugf("[Optimizer] cache usage: %d/%d", len(o.Db[job.peer]), o.CacheSize)
+
+			if len(o.Db[job.peer]) < o.CacheSize {
+				// If the array is not full to CacheSize, append the result
+				o.Db[job.peer] = append(o.Db[job.peer], result)
+			} else {
+				// If the array is full to probeCacheSize...
+				if o.ExitOnCacheFull {
+					cacheFull = true
+					return
+				}
+				// Chop off the first element and append the result
+				o.Db[job.peer] = append(o.Db[job.peer][1:], result)
+			}
+		}(job)
+	}
+	wg.Wait()
+
+	return cacheFull
+}
+
+// computeMetrics calculates latency and packet loss metrics of every peer, depreferences or restores peers, and steers destination prefixes
+func computeMetrics(o *config.Optimizer, global *config.Config, reload func() (*config.Config, error), noConfigure bool, dryRun bool) {
+	window := time.Duration(o.Window) * time.Second
+	now := time.Now()
+	changed := false
+	metrics := map[string]*Metrics{}
+	for peer := range o.Db {
 		peerASN, peerName := parsePeerDelimiter(peer)
-		if p[peer].PacketLoss >= o.PacketLossThreshold {
-			alerts = append(
-				alerts,
-				fmt.Sprintf("Peer AS%s %s met or exceeded maximum allowable packet loss: %.1f >= %.1f",
-					peerASN, peerName, p[peer].PacketLoss, o.PacketLossThreshold,
-				),
-			)
-		}
-		if p[peer].Latency >= time.Duration(o.LatencyThreshold)*time.Millisecond {
-			alerts = append(
-				alerts,
-				fmt.Sprintf("Peer AS%s %s met or exceeded maximum allowable latency: %v >= %v",
-					peerASN, peerName, p[peer].Latency, o.LatencyThreshold,
-				),
-			)
-		}
-
-		// If there is at least one alert,
-		if len(alerts) > 0 {
-			for _, alert := range alerts {
-				log.Debugf("[Optimizer] %s", alert)
-				if o.AlertScript != "" {
-					//nolint:golint,gosec
-					birdCmd := exec.Command(o.AlertScript, alert)
-					birdCmd.Stdout = os.Stdout
-					birdCmd.Stderr = os.Stderr
-					if err := birdCmd.Run(); err != nil {
-						log.Warnf("[Optimizer] alert script: %v", err)
-					}
+		m := computePeerMetrics(o.Db[peer], window, now)
+		metrics[peer] = m
+		if m == nil {
+			log.Debugf("[Optimizer] No probe results for AS%s %s in the last %s", peerASN, peerName, window)
+			continue
+		}
+		log.Debugf("[Optimizer] AS%s %s: %d probes, latency avg %s p50 %s p95 %s p99 %s, jitter %s, packet loss %.1f%%",
+			peerASN, peerName, m.Probes, m.Latency, m.P50, m.P95, m.P99, m.Jitter, m.PacketLoss)
+
+		// Check thresholds to apply optimizations
+		alerts := thresholdAlerts(o, peerASN, peerName, m)
+		for _, alert := range alerts {
+			log.Debugf("[Optimizer] %s", alert.Message)
+		}
+
+		// Only modify local pref after enough consecutive unhealthy or healthy windows
+		peerData := global.Peers[peerName]
+		optimizeInbound := peerData != nil && *peerData.OptimizeInbound
+		if updateState(o, peer, len(alerts) == 0) {
+			changed = true
+			if optimizeInbound {
+				if o.State[peer].Degraded {
+					log.Printf("[Optimizer] Lowering AS%s %s local-pref from %d to %d", peerASN, peerName, *peerData.LocalPref, degradedLocalPref(*peerData.LocalPref, o.LocalPrefModifier))
+				} else {
+					log.Printf("[Optimizer] Restoring AS%s %s local-pref to %d", peerASN, peerName, *peerData.LocalPref)
 				}
 			}
-			modifyPref(peer,
-				global.Peers,
-				o.LocalPrefModifier,
-				global.CacheDirectory,
-				global.BIRDDirectory,
-				global.BIRDSocket,
-				global.BIRDBinary,
-				noConfigure,
-				dryRun,
-			)
+		}
+
+		// Send alerts that haven't already been sent
+		action := ActionNone
+		if optimizeInbound && o.State[peer] != nil && o.State[peer].Degraded {
+			action = ActionDepreferred
+		}
+		for _, alert := range dedupAlerts(o, peer, alerts, now) {
+			alert.Time = now.UTC().Format(time.RFC3339)
+			alert.Action = action
+			sendAlert(o, alert)
 		}
 	}
-}
 
-func modifyPref(
-	peerPair string,
-	peers map[string]*config.Peer,
-	localPrefModifier uint,
-	cacheDirectory string,
-	birdDirectory string,
-	birdSocket string,
-	birdBinary string,
-	noConfigure bool,
-	dryRun bool,
-) {
-	peerASN, peerName := parsePeerDelimiter(peerPair)
-	fileName := path.Join(birdDirectory, fmt.Sprintf("AS%s_%s.conf", peerASN, *util.Sanitize(peerName)))
-	peerFile, err := os.ReadFile(fileName)
-	if err != nil {
-		log.Fatalf("reading peer file: %s", err)
+	updateStatus(o, global, metrics, now)
+
+	// Steer destination prefixes to the best performing peer
+	if len(o.SteerPrefixes) > 0 {
+		steering := computeSteering(o, now)
+		if steeringChanged(o.Steering, steering) {
+			o.Steering = steering
+			changed = true
+		}
 	}
 
-	peerData := peers[peerName]
-	if *peerData.OptimizeInbound {
-		// Calculate new local pref
-		currentLocalPref := *peerData.LocalPref
-		newLocalPref := uint(currentLocalPref) - localPrefModifier
+	if dryRun {
+		return
+	}
 
-		lpRegex := regexp.MustCompile(`bgp_local_pref = .*; # pathvector:localpref`)
-		modified := lpRegex.ReplaceAllString(string(peerFile), fmt.Sprintf("bgp_local_pref = %d; # pathvector:localpref", newLocalPref))
+	if err := saveState(global.CacheDirectory, o.State); err != nil {
+		log.Warnf("[Optimizer] Writing optimizer state: %v", err)
+	}
+	if err := saveSteering(global.CacheDirectory, o.Steering); err != nil {
+		log.Warnf("[Optimizer] Writing optimizer steering: %v", err)
+	}
+	if changed {
+		applyOverrides(o, global, reload, noConfigure)
+	}
+}
 
-		//nolint:golint,gosec
-		if err := os.WriteFile(fileName, []byte(modified), 0644); err != nil {
-			log.Fatal(err)
+// applyOverrides writes the optimizer include file to the BIRD directory and reconfigures BIRD. The include file is
+// rendered from the current config, falling back to the config loaded at startup if it can't be reloaded, and keeps the
+// definitions of any peers in the previous include file that aren't in the config.
+func applyOverrides(o *config.Optimizer, global *config.Config, reload func() (*config.Config, error), noConfigure bool) {
+	c := global
+	if reload != nil {
+		reloaded, err := reload()
+		if err != nil {
+			log.Warnf("[Optimizer] Reloading config, using the config loaded at startup: %v", err)
 		} else {
-			log.Printf("[Optimizer] Lowered AS%s %s local-pref from %d to %d", peerASN, peerName, currentLocalPref, newLocalPref)
+			c = reloaded
 		}
 	}
 
+	overrides := Overrides(c, o.State, o.Steering)
+	previous, err := os.ReadFile(path.Join(global.BIRDDirectory, OverridesFile))
+	if err != nil && !os.IsNotExist(err) {
+		log.Warnf("[Optimizer] Reading previous optimizer include file: %v", err)
+	}
+	overrides = keepUnknownOverrides(overrides, string(previous))
+
+	//nolint:golint,gosec
+	if err := os.WriteFile(path.Join(global.BIRDDirectory, OverridesFile), []byte(overrides), 0644); err != nil {
+		log.Fatalf("[Optimizer] Writing optimizer include file: %v", err)
+	}
+
 	// Run BIRD config validation
-	bird.Validate(birdBinary, birdDirectory)
+	bird.Validate(global.BIRDBinary, global.BIRDDirectory)
 
-	if !dryRun {
-		bird.MoveCacheAndReconfigure(birdDirectory, cacheDirectory, birdSocket, noConfigure)
+	if !noConfigure {
+		bird.Reconfigure(global.BIRDSocket)
 	}
 }
@@ -1,7 +1,18 @@
 package optimizer
 
 import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/go-ping/ping"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/natesales/pathvector/pkg/config"
 )
 
 func TestOptimizerSameAddressFamily(t *testing.T) {
@@ -22,3 +33,314 @@ func TestOptimizerSameAddressFamily(t *testing.T) {
 		}
 	}
 }
+
+func TestOptimizerDb(t *testing.T) {
+	file := path.Join(t.TempDir(), DbFile)
+	now := time.Now()
+	for i, r := range []Record{
+		{ASN: "65510", Peer: "Example", ProbeResult: config.ProbeResult{Time: now.Add(-48 * time.Hour).UnixNano()}},
+		{ASN: "65510", Peer: "Example", ProbeResult: config.ProbeResult{Time: now.Add(-3 * time.Hour).UnixNano(), Stats: ping.Statistics{AvgRtt: 10 * time.Millisecond}}},
+		{ASN: "65510", Peer: "Example", ProbeResult: config.ProbeResult{Time: now.Add(-2 * time.Hour).UnixNano(), Stats: ping.Statistics{AvgRtt: 20 * time.Millisecond}}},
+		{ASN: "65510", Peer: "Example", ProbeResult: config.ProbeResult{Time: now.Add(-1 * time.Hour).UnixNano(), Stats: ping.Statistics{AvgRtt: 30 * time.Millisecond}}},
+		{ASN: "65520", Peer: "Other", ProbeResult: config.ProbeResult{Time: now.Add(-1 * time.Hour).UnixNano(), Stats: ping.Statistics{PacketLoss: 20}}},
+	} {
+		if err := appendDb(file, r); err != nil {
+			t.Fatalf("appending record %d: %s", i, err)
+		}
+	}
+
+	records, err := compactDb(file, 24*time.Hour)
+	assert.Nil(t, err)
+	assert.Len(t, records, 4)
+
+	o := &config.Optimizer{CacheSize: 2, Db: map[string][]config.ProbeResult{}}
+	loadDb(o, records)
+	assert.Len(t, o.Db["65510"+Delimiter+"Example"], 2)
+	assert.Equal(t, 30*time.Millisecond, o.Db["65510"+Delimiter+"Example"][1].Stats.AvgRtt)
+	assert.Len(t, o.Db["65520"+Delimiter+"Other"], 1)
+
+	history, err := History(file, now.Add(-150*time.Minute), "Example")
+	assert.Nil(t, err)
+	assert.Len(t, history, 2)
+	history, err = History(file, now.Add(-150*time.Minute), "AS65520")
+	assert.Nil(t, err)
+	assert.Len(t, history, 1)
+	assert.Equal(t, 20.0, history[0].Stats.PacketLoss)
+}
+
+func TestOptimizerHysteresis(t *testing.T) {
+	o := &config.Optimizer{DegradeAfter: 2, RestoreAfter: 3, State: map[string]*config.OptimizerState{}}
+	peer := "65510" + Delimiter + "Example"
+
+	for i, tc := range []struct {
+		healthy  bool
+		changed  bool
+		degraded bool
+	}{
+		{false, false, false},
+		{true, false, false},
+		{false, false, false},
+		{false, true, true},
+		{false, false, true},
+		{true, false, true},
+		{true, false, true},
+		{false, false, true},
+		{true, false, true},
+		{true, false, true},
+		{true, true, false},
+		{true, false, false},
+	} {
+		assert.Equalf(t, tc.changed, updateState(o, peer, tc.healthy), "window %d", i)
+		assert.Equalf(t, tc.degraded, o.State[peer].Degraded, "window %d", i)
+	}
+}
+
+func TestOptimizerOverrides(t *testing.T) {
+	cacheDirectory := t.TempDir()
+	since := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC).UnixNano()
+	assert.Nil(t, saveState(cacheDirectory, map[string]*config.OptimizerState{
+		"65510" + Delimiter + "Example":  {Degraded: true, Since: since},
+		"65520" + Delimiter + "Healthy":  {Degraded: false},
+		"65530" + Delimiter + "Outbound": {Degraded: true},
+		"65540" + Delimiter + "Low Pref": {Degraded: true, Since: since},
+	}))
+	state, err := LoadState(cacheDirectory)
+	assert.Nil(t, err)
+
+	newPeer := func(asn, localPref int, optimizeInbound bool, steerOutbound bool) *config.Peer {
+		return &config.Peer{ASN: &asn, LocalPref: &localPref, OptimizeInbound: &optimizeInbound, SteerOutbound: &steerOutbound}
+	}
+	c := &config.Config{
+		Optimizer: &config.Optimizer{LocalPrefModifier: 20, SteerModifier: 10},
+		Peers: map[string]*config.Peer{
+			"Example":  newPeer(65510, 100, true, false),
+			"Healthy":  newPeer(65520, 100, true, false),
+			"Outbound": newPeer(65530, 100, false, true),
+			"Low Pref": newPeer(65540, 10, true, true),
+		},
+	}
+	assert.Equal(t, `# Generated by the Pathvector optimizer, do not edit
+# AS65510 Example depreferred since 2026-01-02T03:04:05Z
+define AS65510_EXAMPLE_OPTIMIZER_LOCAL_PREF = 80;
+define AS65520_HEALTHY_OPTIMIZER_LOCAL_PREF = 100;
+# AS65540 Low Pref depreferred since 2026-01-02T03:04:05Z
+define AS65540_LOW_PREF_OPTIMIZER_LOCAL_PREF = 0;
+function AS65540_LOW_PREF_OPTIMIZER_STEER() {
+}
+function AS65530_OUTBOUND_OPTIMIZER_STEER() {
+  if (net.type = NET_IP4 && net ~ [ 192.0.2.0/24+, 198.51.100.0/24+ ]) then bgp_local_pref = bgp_local_pref + 10;
+  if (net.type = NET_IP6 && net ~ [ 2001:db8::/32+ ]) then bgp_local_pref = bgp_local_pref + 10;
+}
+`, Overrides(c, state, map[string]string{
+		"198.51.100.0/24": "65530" + Delimiter + "Outbound",
+		"192.0.2.0/24":    "65530" + Delimiter + "Outbound",
+		"2001:db8::/32":   "65530" + Delimiter + "Outbound",
+	}))
+}
+
+func TestOptimizerKeepUnknownOverrides(t *testing.T) {
+	previous := `# Generated by the Pathvector optimizer, do not edit
+# AS65510 Example depreferred since 2026-01-02T03:04:05Z
+define AS65510_EXAMPLE_OPTIMIZER_LOCAL_PREF = 80;
+define AS65520_NEW_OPTIMIZER_LOCAL_PREF = 100;
+function AS65520_NEW_OPTIMIZER_STEER() {
+  if (net.type = NET_IP4 && net ~ [ 192.0.2.0/24+ ]) then bgp_local_pref = bgp_local_pref + 10;
+}
+`
+	rendered := `# Generated by the Pathvector optimizer, do not edit
+define AS65510_EXAMPLE_OPTIMIZER_LOCAL_PREF = 100;
+`
+	assert.Equal(t, `# Generated by the Pathvector optimizer, do not edit
+define AS65510_EXAMPLE_OPTIMIZER_LOCAL_PREF = 100;
+define AS65520_NEW_OPTIMIZER_LOCAL_PREF = 100;
+function AS65520_NEW_OPTIMIZER_STEER() {
+  if (net.type = NET_IP4 && net ~ [ 192.0.2.0/24+ ]) then bgp_local_pref = bgp_local_pref + 10;
+}
+`, keepUnknownOverrides(rendered, previous))
+	assert.Equal(t, rendered, keepUnknownOverrides(rendered, ""))
+}
+
+func TestOptimizerProbeRound(t *testing.T) {
+	var lock sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		lock.Unlock()
+		time.Sleep(50 * time.Millisecond)
+		lock.Lock()
+		inFlight--
+		lock.Unlock()
+	}))
+	defer server.Close()
+
+	o := &config.Optimizer{
+		Targets:      []string{server.URL, "tcp://" + fakeTCPTarget(t), "2001:db8::1"},
+		PingCount:    1,
+		PingTimeout:  1,
+		CacheSize:    2,
+		ProbeWorkers: 2,
+		ProbeJitter:  10,
+		Db:           map[string][]config.ProbeResult{},
+	}
+	probers := map[string]Prober{}
+	for _, target := range o.Targets {
+		prober, err := NewProber(target, false)
+		assert.Nil(t, err)
+		probers[target] = prober
+	}
+	sourceMap := map[string][]string{
+		"65510" + Delimiter + "Example": {"127.0.0.1"},
+		"65520" + Delimiter + "Other":   {"127.0.0.1"},
+		"65530" + Delimiter + "Third":   {"127.0.0.1"},
+	}
+
+	for i := 0; i < 2; i++ {
+		assert.False(t, probeRound(o, sourceMap, nil, probers, ""))
+	}
+	assert.Equal(t, 2, maxInFlight)
+	for peer := range sourceMap {
+		assert.Len(t, o.Db[peer], 2)
+		for _, result := range o.Db[peer] {
+			assert.Equal(t, 0.0, result.Stats.PacketLoss)
+		}
+	}
+
+	o.ExitOnCacheFull = true
+	assert.True(t, probeRound(o, sourceMap, nil, probers, ""))
+}
+
+// errorProber is a prober that always fails
+type errorProber struct{}
+
+func (p *errorProber) Host() string {
+	return "127.0.0.1"
+}
+
+func (p *errorProber) Probe(string, int, time.Duration) (*ping.Statistics, error) {
+	return nil, errors.New("probe failed")
+}
+
+func TestOptimizerProbeRoundError(t *testing.T) {
+	o := &config.Optimizer{
+		Targets:      []string{"error"},
+		PingCount:    4,
+		PingTimeout:  1,
+		CacheSize:    2,
+		ProbeWorkers: 1,
+		Db:           map[string][]config.ProbeResult{},
+	}
+	peer := "65510" + Delimiter + "Example"
+	assert.False(t, probeRound(o, map[string][]string{peer: {"127.0.0.1"}}, nil, map[string]Prober{"error": &errorProber{}}, ""))
+	assert.Empty(t, o.Db[peer])
+}
+
+func TestOptimizerMetrics(t *testing.T) {
+	now := time.Now()
+	ms := func(values ...int) []time.Duration {
+		var out []time.Duration
+		for _, v := range values {
+			out = append(out, time.Duration(v)*time.Millisecond)
+		}
+		return out
+	}
+	results := []config.ProbeResult{
+		{Time: now.Add(-time.Hour).UnixNano(), Stats: ping.Statistics{PacketsSent: 5, PacketsRecv: 0}},
+		{Time: now.Add(-3 * time.Minute).UnixNano(), Stats: ping.Statistics{PacketsSent: 5, PacketsRecv: 5, Rtts: ms(10, 10, 10, 10, 10)}},
+		{Time: now.Add(-2 * time.Minute).UnixNano(), Stats: ping.Statistics{PacketsSent: 5, PacketsRecv: 5, Rtts: ms(10, 10, 10, 10, 10)}},
+		{Time: now.Add(-1 * time.Minute).UnixNano(), Stats: ping.Statistics{PacketsSent: 15, PacketsRecv: 10, Rtts: ms(10, 10, 10, 10, 10, 10, 10, 10, 100, 200)}},
+	}
+
+	m := computePeerMetrics(results, 10*time.Minute, now)
+	assert.Equal(t, 3, m.Probes)
+	assert.Equal(t, 20.0, m.PacketLoss)
+	assert.Equal(t, 10*time.Millisecond, m.P50)
+	assert.Equal(t, 100*time.Millisecond, m.P95)
+	assert.Equal(t, 200*time.Millisecond, m.P99)
+	assert.Equal(t, 24*time.Millisecond, m.Latency)
+	assert.Equal(t, 44877611*time.Nanosecond, m.Jitter)
+
+	m = computePeerMetrics(results, 0, now)
+	assert.Equal(t, 4, m.Probes)
+	assert.InDelta(t, 33.3, m.PacketLoss, 0.1)
+
+	assert.Nil(t, computePeerMetrics(results, 30*time.Second, now))
+
+	o := &config.Optimizer{PacketLossThreshold: 25, LatencyThreshold: 100, P95Threshold: 100, JitterThreshold: 50}
+	assert.Equal(t, []Alert{{
+		Peer:      "Example",
+		ASN:       65510,
+		Metric:    "latency-p95",
+		Value:     100,
+		Threshold: 100,
+		Unit:      "ms",
+		Message:   "Peer AS65510 Example met or exceeded maximum allowable p95 latency: 100ms >= 100ms",
+	}}, thresholdAlerts(o, "65510", "Example", computePeerMetrics(results, 10*time.Minute, now)))
+	o.P95Threshold = 0
+	alerts := thresholdAlerts(o, "65510", "Example", m)
+	assert.Len(t, alerts, 1)
+	assert.Equal(t, "packet-loss", alerts[0].Metric)
+	assert.Equal(t, "Peer AS65510 Example met or exceeded maximum allowable packet loss: 33.3 >= 25.0", alerts[0].Message)
+}
+
+func TestOptimizerSteering(t *testing.T) {
+	now := time.Now()
+	result := func(sent, recv int, rtt time.Duration) []config.ProbeResult {
+		var rtts []time.Duration
+		for i := 0; i < recv; i++ {
+			rtts = append(rtts, rtt)
+		}
+		return []config.ProbeResult{{Time: now.UnixNano(), Stats: ping.Statistics{PacketsSent: sent, PacketsRecv: recv, Rtts: rtts}}}
+	}
+	a, b, c := "65510"+Delimiter+"A", "65520"+Delimiter+"B", "65530"+Delimiter+"C"
+
+	o := &config.Optimizer{
+		PacketLossThreshold: 50,
+		SteerMaxPrefixes:    2,
+		SteerMinProbes:      1,
+		SteerDb: map[string]map[string][]config.ProbeResult{
+			// B is fastest
+			"192.0.2.0/24": {a: result(4, 4, 30*time.Millisecond), b: result(4, 4, 10*time.Millisecond)},
+			// C is faster but lossy, so A wins
+			"198.51.100.0/24": {a: result(4, 4, 50*time.Millisecond), b: result(4, 4, 80*time.Millisecond), c: result(4, 3, 5*time.Millisecond)},
+			// All peers exceed the packet loss threshold
+			"203.0.113.0/24": {a: result(4, 1, 10*time.Millisecond), b: result(4, 0, 0)},
+			// Smallest improvement, dropped by steer-max-prefixes
+			"2001:db8::/32": {a: result(4, 4, 10*time.Millisecond), b: result(4, 4, 11*time.Millisecond)},
+			// Only one peer has probe results
+			"2001:db8:1::/48": {a: result(4, 4, 10*time.Millisecond)},
+			// Peers perform the same
+			"2001:db8:2::/48": {a: result(4, 4, 10*time.Millisecond), b: result(4, 4, 10*time.Millisecond)},
+		},
+	}
+	assert.Equal(t, map[string]string{
+		"192.0.2.0/24":    b,
+		"198.51.100.0/24": a,
+	}, computeSteering(o, now))
+
+	o.SteerMaxPrefixes = 10
+	steering := computeSteering(o, now)
+	assert.Len(t, steering, 3)
+	assert.Equal(t, a, steering["2001:db8::/32"])
+
+	assert.True(t, steeringChanged(map[string]string{"192.0.2.0/24": a}, steering))
+	assert.False(t, steeringChanged(steering, steering))
+
+	// Latency improvements below steer-min-improvement aren't steered
+	o.SteerMinImprovement = 5
+	assert.Equal(t, map[string]string{
+		"192.0.2.0/24":    b,
+		"198.51.100.0/24": a,
+	}, computeSteering(o, now))
+
+	// Peers need steer-min-probes probe runs to be compared
+	o.SteerMinProbes = 2
+	assert.Empty(t, computeSteering(o, now))
+
+	assert.Nil(t, validateSteerPrefixes(map[string][]string{"192.0.2.0/24": nil, "2001:db8::/32": nil}))
+	assert.NotNil(t, validateSteerPrefixes(map[string][]string{"192.0.2.1/24": nil}))
+	assert.NotNil(t, validateSteerPrefixes(map[string][]string{"invalid": nil}))
+}
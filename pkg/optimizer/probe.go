@@ -0,0 +1,227 @@
+package optimizer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-ping/ping"
+)
+
+// Prober sends probes of a single type to a target
+type Prober interface {
+	// Host returns the target's IP address or hostname
+	Host() string
+
+	// Probe sends count probes from a source address and returns the probe statistics. Probes that the target doesn't
+	// answer are counted as lost, and an error is returned if the probes couldn't be sent at all.
+	Probe(source string, count int, timeout time.Duration) (*ping.Statistics, error)
+}
+
+// icmpProber sends ICMP echo requests, or unprivileged UDP pings
+type icmpProber struct {
+	host string
+	udp  bool
+}
+
+// tcpProber measures TCP connection setup time to a port
+type tcpProber struct {
+	host string
+	port string
+}
+
+// httpProber measures the time to receive a response to an HTTP GET request
+type httpProber struct {
+	url  string
+	host string
+}
+
+// NewProber parses a probe target. Targets are an IP address or hostname for ICMP probes,
+// or a URL in the form icmp://host, tcp://host:port, http://host/path or https://host/path.
+func NewProber(target string, udp bool) (Prober, error) {
+	if !strings.Contains(target, "://") {
+		return &icmpProber{host: target, udp: udp}, nil
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid probe target %s: %s", target, err)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid probe target %s: no host", target)
+	}
+
+	switch u.Scheme {
+	case "icmp":
+		return &icmpProber{host: u.Hostname(), udp: udp}, nil
+	case "tcp":
+		if u.Port() == "" {
+			return nil, fmt.Errorf("invalid probe target %s: TCP probes require a port", target)
+		}
+		return &tcpProber{host: u.Hostname(), port: u.Port()}, nil
+	case "http", "https":
+		return &httpProber{url: target, host: u.Hostname()}, nil
+	default:
+		return nil, fmt.Errorf("invalid probe target %s: unknown probe type %s", target, u.Scheme)
+	}
+}
+
+// network returns a network name restricted to the address family of a source address
+func network(base string, source string) string {
+	if net.ParseIP(source).To4() != nil {
+		return base + "4"
+	}
+	return base + "6"
+}
+
+// localError returns true if a probe failed because of the local host, such as an unconfigured source address or a
+// failed DNS lookup, rather than because the target didn't respond
+func localError(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) ||
+		errors.Is(err, syscall.EADDRNOTAVAIL) ||
+		errors.Is(err, syscall.EADDRINUSE) ||
+		errors.Is(err, syscall.EACCES) ||
+		errors.Is(err, syscall.EPERM)
+}
+
+// statistics computes probe statistics from a list of round trip times
+func statistics(addr string, sent int, rtts []time.Duration) *ping.Statistics {
+	stats := &ping.Statistics{
+		Addr:        addr,
+		PacketsSent: sent,
+		PacketsRecv: len(rtts),
+		Rtts:        rtts,
+	}
+	if sent > 0 {
+		stats.PacketLoss = float64(sent-len(rtts)) / float64(sent) * 100
+	}
+	if len(rtts) == 0 {
+		return stats
+	}
+
+	var total time.Duration
+	stats.MinRtt = rtts[0]
+	for _, rtt := range rtts {
+		total += rtt
+		if rtt < stats.MinRtt {
+			stats.MinRtt = rtt
+		}
+		if rtt > stats.MaxRtt {
+			stats.MaxRtt = rtt
+		}
+	}
+	stats.AvgRtt = total / time.Duration(len(rtts))
+
+	var sumSquares time.Duration
+	for _, rtt := range rtts {
+		sumSquares += (rtt - stats.AvgRtt) * (rtt - stats.AvgRtt)
+	}
+	stats.StdDevRtt = time.Duration(math.Sqrt(float64(sumSquares / time.Duration(len(rtts)))))
+
+	return stats
+}
+
+func (p *icmpProber) Host() string {
+	return p.host
+}
+
+// Probe sends a probe ping to the target
+func (p *icmpProber) Probe(source string, count int, timeout time.Duration) (*ping.Statistics, error) {
+	// Resolve hostnames in the source's address family
+	pinger := ping.New(p.host)
+	pinger.SetNetwork(network("ip", source))
+	if err := pinger.Resolve(); err != nil {
+		return &ping.Statistics{}, err
+	}
+
+	// Set pinger options
+	pinger.Count = count
+	pinger.Timeout = timeout
+	pinger.Source = source
+	pinger.SetPrivileged(!p.udp)
+
+	// Run the ping
+	if err := pinger.Run(); err != nil {
+		return &ping.Statistics{}, fmt.Errorf("ping: %s", err)
+	}
+
+	return pinger.Statistics(), nil // nil error
+}
+
+func (p *tcpProber) Host() string {
+	return p.host
+}
+
+// Probe opens count TCP connections to the target, counting failed connections as lost
+func (p *tcpProber) Probe(source string, count int, timeout time.Duration) (*ping.Statistics, error) {
+	dialer := net.Dialer{
+		Timeout:   timeout,
+		LocalAddr: &net.TCPAddr{IP: net.ParseIP(source)},
+	}
+	addr := net.JoinHostPort(p.host, p.port)
+
+	var rtts []time.Duration
+	for i := 0; i < count; i++ {
+		start := time.Now()
+		conn, err := dialer.Dial(network("tcp", source), addr)
+		if err != nil {
+			if localError(err) {
+				return &ping.Statistics{}, err
+			}
+			continue
+		}
+		rtts = append(rtts, time.Since(start))
+		_ = conn.Close()
+	}
+
+	return statistics(addr, count, rtts), nil // nil error
+}
+
+func (p *httpProber) Host() string {
+	return p.host
+}
+
+// Probe sends count HTTP GET requests to the target, counting failed requests and non-2xx responses as lost
+func (p *httpProber) Probe(source string, count int, timeout time.Duration) (*ping.Statistics, error) {
+	dialer := net.Dialer{
+		Timeout:   timeout,
+		LocalAddr: &net.TCPAddr{IP: net.ParseIP(source)},
+	}
+	client := &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, addr string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network("tcp", source), addr)
+			},
+			DisableKeepAlives: true,
+		},
+	}
+
+	var rtts []time.Duration
+	for i := 0; i < count; i++ {
+		start := time.Now()
+		resp, err := client.Get(p.url)
+		if err != nil {
+			if localError(err) {
+				return &ping.Statistics{}, err
+			}
+			continue
+		}
+		rtt := time.Since(start)
+		_ = resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			continue
+		}
+		rtts = append(rtts, rtt)
+	}
+
+	return statistics(p.url, count, rtts), nil // nil error
+}
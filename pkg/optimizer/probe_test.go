@@ -0,0 +1,141 @@
+package optimizer
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeTCPTarget starts a TCP listener on loopback that accepts and closes connections, and returns its address
+func fakeTCPTarget(t *testing.T) string {
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.Close()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// closedTCPTarget returns the address of a loopback port with no listener
+func closedTCPTarget(t *testing.T) string {
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	_ = listener.Close()
+	return addr
+}
+
+func TestNewProber(t *testing.T) {
+	for _, tc := range []struct {
+		target string
+		prober Prober
+		err    bool
+	}{
+		{"192.0.2.1", &icmpProber{host: "192.0.2.1"}, false},
+		{"2001:db8::1", &icmpProber{host: "2001:db8::1"}, false},
+		{"icmp://192.0.2.1", &icmpProber{host: "192.0.2.1"}, false},
+		{"tcp://192.0.2.1:443", &tcpProber{host: "192.0.2.1", port: "443"}, false},
+		{"tcp://[2001:db8::1]:179", &tcpProber{host: "2001:db8::1", port: "179"}, false},
+		{"tcp://192.0.2.1", nil, true},
+		{"https://example.com/health", &httpProber{url: "https://example.com/health", host: "example.com"}, false},
+		{"udp://192.0.2.1:53", nil, true},
+		{"tcp://:443", nil, true},
+	} {
+		prober, err := NewProber(tc.target, false)
+		if tc.err {
+			assert.NotNilf(t, err, "target %s", tc.target)
+			continue
+		}
+		assert.Nilf(t, err, "target %s", tc.target)
+		assert.Equalf(t, tc.prober, prober, "target %s", tc.target)
+	}
+}
+
+func TestProbeFamilyMatches(t *testing.T) {
+	assert.True(t, probeFamilyMatches("192.0.2.1", "192.0.2.2"))
+	assert.False(t, probeFamilyMatches("192.0.2.1", "2001:db8::1"))
+	assert.True(t, probeFamilyMatches("2001:db8::1", "example.com"))
+}
+
+func TestTCPProbe(t *testing.T) {
+	prober, err := NewProber("tcp://"+fakeTCPTarget(t), false)
+	assert.Nil(t, err)
+	stats, err := prober.Probe("127.0.0.1", 3, time.Second)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, stats.PacketsSent)
+	assert.Equal(t, 3, stats.PacketsRecv)
+	assert.Equal(t, 0.0, stats.PacketLoss)
+	assert.Len(t, stats.Rtts, 3)
+	assert.True(t, stats.MinRtt <= stats.AvgRtt && stats.AvgRtt <= stats.MaxRtt)
+
+	prober, err = NewProber("tcp://"+closedTCPTarget(t), false)
+	assert.Nil(t, err)
+	stats, err = prober.Probe("127.0.0.1", 2, time.Second)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, stats.PacketsRecv)
+	assert.Equal(t, 100.0, stats.PacketLoss)
+
+	// Sources that aren't configured locally aren't counted as loss
+	_, err = prober.Probe("192.0.2.123", 2, time.Second)
+	assert.NotNil(t, err)
+	assert.True(t, localError(err))
+}
+
+func TestHTTPProbe(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	prober, err := NewProber(server.URL+"/health", false)
+	assert.Nil(t, err)
+	stats, err := prober.Probe("127.0.0.1", 4, time.Second)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, requests)
+	assert.Equal(t, 4, stats.PacketsRecv)
+	assert.Equal(t, 0.0, stats.PacketLoss)
+
+	// Non-2xx responses are lost
+	errorServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer errorServer.Close()
+	prober, err = NewProber(errorServer.URL+"/health", false)
+	assert.Nil(t, err)
+	stats, err = prober.Probe("127.0.0.1", 2, time.Second)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, stats.PacketsRecv)
+	assert.Equal(t, 100.0, stats.PacketLoss)
+
+	prober, err = NewProber("http://"+closedTCPTarget(t)+"/health", false)
+	assert.Nil(t, err)
+	stats, err = prober.Probe("127.0.0.1", 2, time.Second)
+	assert.Nil(t, err)
+	assert.Equal(t, 100.0, stats.PacketLoss)
+}
+
+func TestProbeStatistics(t *testing.T) {
+	stats := statistics("192.0.2.1", 4, []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 30 * time.Millisecond})
+	assert.Equal(t, 25.0, stats.PacketLoss)
+	assert.Equal(t, 10*time.Millisecond, stats.MinRtt)
+	assert.Equal(t, 30*time.Millisecond, stats.MaxRtt)
+	assert.Equal(t, 20*time.Millisecond, stats.AvgRtt)
+	assert.Equal(t, 8164965*time.Nanosecond, stats.StdDevRtt)
+}
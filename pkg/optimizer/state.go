@@ -0,0 +1,170 @@
+package optimizer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/natesales/pathvector/pkg/config"
+	"github.com/natesales/pathvector/pkg/util"
+)
+
+const (
+	// StateFile is the name of the optimizer state file in the cache directory
+	StateFile = "optimizer-state.json"
+
+	// OverridesFile is the name of the BIRD include file containing the optimizer's per-peer adjustments
+	OverridesFile = "optimizer.conf"
+)
+
+// LoadState reads the optimizer state file from the cache directory
+func LoadState(cacheDirectory string) (map[string]*config.OptimizerState, error) {
+	state := map[string]*config.OptimizerState{}
+	contents, err := os.ReadFile(path.Join(cacheDirectory, StateFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(contents, &state); err != nil {
+		return nil, fmt.Errorf("optimizer state JSON unmarshal: %s", err)
+	}
+	return state, nil
+}
+
+// saveState writes the optimizer state file to the cache directory
+func saveState(cacheDirectory string, state map[string]*config.OptimizerState) error {
+	j, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	//nolint:golint,gosec
+	return os.WriteFile(path.Join(cacheDirectory, StateFile), j, 0644)
+}
+
+// degradedLocalPref returns the local pref of a depreferred peer
+func degradedLocalPref(localPref int, modifier uint) int {
+	if uint(localPref) < modifier {
+		return 0
+	}
+	return localPref - int(modifier)
+}
+
+// Overrides renders the optimizer include file, defining the local pref of every peer with optimize-inbound enabled
+// and the steering function of every peer with steer-outbound enabled. Peers that are currently depreferred have their
+// local pref lowered by the local pref modifier, and routes to prefixes steered to a peer have their local pref raised.
+func Overrides(c *config.Config, state map[string]*config.OptimizerState, steering map[string]string) string {
+	var peerNames []string
+	for peerName := range c.Peers {
+		peerNames = append(peerNames, peerName)
+	}
+	sort.Strings(peerNames)
+
+	// Group steered prefixes by peer
+	steered := map[string][]string{}
+	for prefix, peer := range steering {
+		steered[peer] = append(steered[peer], prefix)
+	}
+
+	var b strings.Builder
+	b.WriteString("# Generated by the Pathvector optimizer, do not edit\n")
+	for _, peerName := range peerNames {
+		peerData := c.Peers[peerName]
+		peer := fmt.Sprintf("%d%s%s", *peerData.ASN, Delimiter, peerName)
+		if *peerData.OptimizeInbound {
+			localPref := *peerData.LocalPref
+			if s := state[peer]; s != nil && s.Degraded {
+				localPref = degradedLocalPref(localPref, c.Optimizer.LocalPrefModifier)
+				b.WriteString(fmt.Sprintf("# AS%d %s depreferred since %s\n", *peerData.ASN, peerName, time.Unix(0, s.Since).UTC().Format(time.RFC3339)))
+			}
+			b.WriteString(fmt.Sprintf("define AS%d_%s_OPTIMIZER_LOCAL_PREF = %d;\n", *peerData.ASN, *util.Sanitize(peerName), localPref))
+		}
+		if *peerData.SteerOutbound {
+			prefixes := steered[peer]
+			sort.Strings(prefixes)
+			b.WriteString(steerFunction(*peerData.ASN, *util.Sanitize(peerName), prefixes, c.Optimizer.SteerModifier))
+		}
+	}
+	return b.String()
+}
+
+// WriteOverrides writes the optimizer include file to a BIRD config directory
+func WriteOverrides(c *config.Config, state map[string]*config.OptimizerState, steering map[string]string, directory string) error {
+	//nolint:golint,gosec
+	return os.WriteFile(path.Join(directory, OverridesFile), []byte(Overrides(c, state, steering)), 0644)
+}
+
+// overrideDefinitions splits an optimizer include file into its local pref defines and steering functions, returning the
+// defined names in order and the lines of each definition
+func overrideDefinitions(overrides string) ([]string, map[string]string) {
+	var names []string
+	definitions := map[string]string{}
+	var name string
+	for _, line := range strings.SplitAfter(overrides, "\n") {
+		switch {
+		case name != "":
+			// Inside a steering function
+			definitions[name] += line
+			if strings.TrimSpace(line) == "}" {
+				name = ""
+			}
+		case strings.HasPrefix(line, "define "):
+			fields := strings.Fields(line)
+			if len(fields) > 1 {
+				names = append(names, fields[1])
+				definitions[fields[1]] = line
+			}
+		case strings.HasPrefix(line, "function "):
+			name = strings.SplitN(strings.TrimPrefix(line, "function "), "(", 2)[0]
+			names = append(names, name)
+			definitions[name] = line
+		}
+	}
+	return names, definitions
+}
+
+// keepUnknownOverrides appends the definitions of a previous optimizer include file that aren't in the rendered include
+// file, so that peer configs referencing them stay valid until the optimizer's config includes their peers
+func keepUnknownOverrides(rendered string, previous string) string {
+	_, defined := overrideDefinitions(rendered)
+	names, previousDefinitions := overrideDefinitions(previous)
+	for _, name := range names {
+		if _, found := defined[name]; !found {
+			rendered += previousDefinitions[name]
+		}
+	}
+	return rendered
+}
+
+// updateState records the result of a probe window for a peer and returns true if the peer's degraded state changed
+func updateState(o *config.Optimizer, peer string, healthy bool) bool {
+	s := o.State[peer]
+	if s == nil {
+		s = &config.OptimizerState{}
+		o.State[peer] = s
+	}
+
+	if healthy {
+		s.GoodWindows++
+		s.BadWindows = 0
+		if s.Degraded && s.GoodWindows >= o.RestoreAfter {
+			s.Degraded = false
+			s.Since = time.Now().UnixNano()
+			return true
+		}
+	} else {
+		s.BadWindows++
+		s.GoodWindows = 0
+		if !s.Degraded && s.BadWindows >= o.DegradeAfter {
+			s.Degraded = true
+			s.Since = time.Now().UnixNano()
+			return true
+		}
+	}
+	return false
+}
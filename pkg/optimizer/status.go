@@ -0,0 +1,274 @@
+package optimizer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/natesales/pathvector/pkg/config"
+)
+
+// PeerStatus is the optimizer's current view of a peer
+type PeerStatus struct {
+	ASN            int     `json:"asn"`
+	Peer           string  `json:"peer"`
+	Probes         int     `json:"probes"`
+	Latency        float64 `json:"latency_ms"`
+	P50            float64 `json:"latency_p50_ms"`
+	P95            float64 `json:"latency_p95_ms"`
+	P99            float64 `json:"latency_p99_ms"`
+	Jitter         float64 `json:"jitter_ms"`
+	PacketLoss     float64 `json:"packet_loss"`
+	CacheUsed      int     `json:"cache_used"`
+	CacheSize      int     `json:"cache_size"`
+	Degraded       bool    `json:"degraded"`
+	LocalPref      int     `json:"local_pref,omitempty"`
+	LastAdjustment string  `json:"last_adjustment,omitempty"`
+}
+
+// Status is the optimizer's current view of all peers
+type Status struct {
+	Updated string       `json:"updated"`
+	Peers   []PeerStatus `json:"peers"`
+}
+
+var (
+	statusLock    sync.RWMutex
+	currentStatus = Status{Peers: []PeerStatus{}}
+)
+
+// updateStatus replaces the current status with the metrics of the latest probe round
+func updateStatus(o *config.Optimizer, global *config.Config, metrics map[string]*Metrics, now time.Time) {
+	var peers []string
+	for peer := range o.Db {
+		peers = append(peers, peer)
+	}
+	sort.Strings(peers)
+
+	status := Status{
+		Updated: now.UTC().Format(time.RFC3339),
+		Peers:   []PeerStatus{},
+	}
+	for _, peer := range peers {
+		peerASN, peerName := parsePeerDelimiter(peer)
+		asn, _ := strconv.Atoi(peerASN)
+		ps := PeerStatus{
+			ASN:       asn,
+			Peer:      peerName,
+			CacheUsed: len(o.Db[peer]),
+			CacheSize: o.CacheSize,
+		}
+		if m := metrics[peer]; m != nil {
+			ps.Probes = m.Probes
+			ps.Latency = float64(m.Latency) / float64(time.Millisecond)
+			ps.P50 = float64(m.P50) / float64(time.Millisecond)
+			ps.P95 = float64(m.P95) / float64(time.Millisecond)
+			ps.P99 = float64(m.P99) / float64(time.Millisecond)
+			ps.Jitter = float64(m.Jitter) / float64(time.Millisecond)
+			ps.PacketLoss = m.PacketLoss
+		}
+		if s := o.State[peer]; s != nil {
+			ps.Degraded = s.Degraded
+			if s.Since != 0 {
+				ps.LastAdjustment = time.Unix(0, s.Since).UTC().Format(time.RFC3339)
+			}
+		}
+		if peerData := global.Peers[peerName]; peerData != nil && peerData.LocalPref != nil {
+			ps.LocalPref = *peerData.LocalPref
+			if ps.Degraded && peerData.OptimizeInbound != nil && *peerData.OptimizeInbound {
+				ps.LocalPref = degradedLocalPref(ps.LocalPref, o.LocalPrefModifier)
+			}
+		}
+		status.Peers = append(status.Peers, ps)
+	}
+
+	statusLock.Lock()
+	currentStatus = status
+	statusLock.Unlock()
+}
+
+// getStatus returns the current status
+func getStatus() Status {
+	statusLock.RLock()
+	defer statusLock.RUnlock()
+	return currentStatus
+}
+
+// promLabelEscaper escapes Prometheus label values
+var promLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// prometheusMetrics renders a status in the Prometheus text exposition format
+func prometheusMetrics(status Status) string {
+	var b strings.Builder
+	metric := func(name string, help string, value func(ps PeerStatus) (float64, bool), extraLabels string) {
+		b.WriteString(fmt.Sprintf("# HELP %s %s\n# TYPE %s gauge\n", name, help, name))
+		for _, ps := range status.Peers {
+			v, ok := value(ps)
+			if !ok {
+				continue
+			}
+			b.WriteString(fmt.Sprintf("%s{asn=\"%d\",peer=\"%s\"%s} %s\n",
+				name, ps.ASN, promLabelEscaper.Replace(ps.Peer), extraLabels, strconv.FormatFloat(v, 'f', -1, 64)))
+		}
+	}
+	always := func(f func(ps PeerStatus) float64) func(ps PeerStatus) (float64, bool) {
+		return func(ps PeerStatus) (float64, bool) { return f(ps), true }
+	}
+	measured := func(f func(ps PeerStatus) float64) func(ps PeerStatus) (float64, bool) {
+		return func(ps PeerStatus) (float64, bool) { return f(ps), ps.Probes > 0 }
+	}
+
+	metric("pathvector_optimizer_probes", "Number of probe results in the metrics window", always(func(ps PeerStatus) float64 { return float64(ps.Probes) }), "")
+	metric("pathvector_optimizer_latency_seconds", "Average probe latency", measured(func(ps PeerStatus) float64 { return ps.Latency / 1000 }), "")
+	for _, q := range []struct {
+		quantile string
+		value    func(ps PeerStatus) float64
+	}{
+		{"0.5", func(ps PeerStatus) float64 { return ps.P50 / 1000 }},
+		{"0.95", func(ps PeerStatus) float64 { return ps.P95 / 1000 }},
+		{"0.99", func(ps PeerStatus) float64 { return ps.P99 / 1000 }},
+	} {
+		metric("pathvector_optimizer_latency_quantile_seconds", "Probe latency percentile", measured(q.value), fmt.Sprintf(",quantile=\"%s\"", q.quantile))
+	}
+	metric("pathvector_optimizer_jitter_seconds", "Standard deviation of probe latency", measured(func(ps PeerStatus) float64 { return ps.Jitter / 1000 }), "")
+	metric("pathvector_optimizer_packet_loss_ratio", "Probe packet loss", measured(func(ps PeerStatus) float64 { return ps.PacketLoss / 100 }), "")
+	metric("pathvector_optimizer_cache_results", "Number of probe results in the cache", always(func(ps PeerStatus) float64 { return float64(ps.CacheUsed) }), "")
+	metric("pathvector_optimizer_cache_size", "Maximum number of probe results in the cache", always(func(ps PeerStatus) float64 { return float64(ps.CacheSize) }), "")
+	metric("pathvector_optimizer_degraded", "Whether the peer is depreferred by the optimizer", always(func(ps PeerStatus) float64 {
+		if ps.Degraded {
+			return 1
+		}
+		return 0
+	}), "")
+	metric("pathvector_optimizer_local_pref", "Current local pref of the peer", always(func(ps PeerStatus) float64 { return float64(ps.LocalPref) }), "")
+	metric("pathvector_optimizer_last_adjustment_timestamp_seconds", "Time the peer was last depreferred or restored", func(ps PeerStatus) (float64, bool) {
+		t, err := time.Parse(time.RFC3339, ps.LastAdjustment)
+		if err != nil {
+			return 0, false
+		}
+		return float64(t.Unix()), true
+	}, "")
+
+	return b.String()
+}
+
+// statusHandler serves the current status as JSON on /status and as Prometheus metrics on /metrics
+func statusHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(getStatus()); err != nil {
+			log.Warnf("[Optimizer] Writing status: %v", err)
+		}
+	})
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		if _, err := w.Write([]byte(prometheusMetrics(getStatus()))); err != nil {
+			log.Warnf("[Optimizer] Writing metrics: %v", err)
+		}
+	})
+	return mux
+}
+
+// errAlreadyRunning is returned when another optimizer is serving its status on the status socket
+var errAlreadyRunning = errors.New("another optimizer is already running")
+
+// serveSocket starts serving the optimizer status on a UNIX socket
+func serveSocket(socket string) error {
+	if err := os.MkdirAll(path.Dir(socket), 0755); err != nil {
+		return fmt.Errorf("creating optimizer status socket directory: %s", err)
+	}
+	// Only remove a stale socket left by a previous optimizer, not one another optimizer is listening on
+	conn, err := net.DialTimeout("unix", socket, time.Second)
+	switch {
+	case err == nil:
+		_ = conn.Close()
+		return fmt.Errorf("%w on %s", errAlreadyRunning, socket)
+	case errors.Is(err, syscall.ECONNREFUSED):
+		if err := os.Remove(socket); err != nil {
+			return fmt.Errorf("removing stale optimizer status socket: %s", err)
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return fmt.Errorf("checking optimizer status socket: %s", err)
+	}
+
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		return fmt.Errorf("listening on optimizer status socket: %s", err)
+	}
+	log.Infof("[Optimizer] Serving status on %s", socket)
+	go serve(listener)
+	return nil
+}
+
+// ServeStatus starts serving the optimizer status on the configured UNIX socket and HTTP listen address. The optimizer
+// keeps running without the status socket if it can't be served, such as when the socket directory isn't writable, but
+// returns an error if another optimizer is already serving on it.
+func ServeStatus(o *config.Optimizer) error {
+	if o.StatusSocket != "" {
+		if err := serveSocket(o.StatusSocket); errors.Is(err, errAlreadyRunning) {
+			return err
+		} else if err != nil {
+			log.Warnf("[Optimizer] Not serving status on %s: %v", o.StatusSocket, err)
+		}
+	}
+	if o.StatusListen != "" {
+		listener, err := net.Listen("tcp", o.StatusListen)
+		if err != nil {
+			return fmt.Errorf("listening on optimizer status address: %s", err)
+		}
+		log.Infof("[Optimizer] Serving status and metrics on http://%s", o.StatusListen)
+		go serve(listener)
+	}
+	return nil
+}
+
+// serve serves the status handler on a listener
+func serve(listener net.Listener) {
+	//nolint:golint,gosec
+	if err := http.Serve(listener, statusHandler()); err != nil {
+		log.Warnf("[Optimizer] Status server: %v", err)
+	}
+}
+
+// QueryStatus fetches the status of a running optimizer from an HTTP URL, or from a UNIX socket if url is empty
+func QueryStatus(socket string, url string) (*Status, error) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	if url == "" {
+		url = "http://unix"
+		client.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		}
+	}
+
+	resp, err := client.Get(strings.TrimSuffix(url, "/") + "/status")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	var status Status
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil, fmt.Errorf("status JSON decode: %s", err)
+	}
+	return &status, nil
+}
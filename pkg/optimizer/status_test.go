@@ -0,0 +1,112 @@
+package optimizer
+
+import (
+	"net"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/go-ping/ping"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/natesales/pathvector/pkg/config"
+)
+
+func TestOptimizerStatus(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	example, other := "65510"+Delimiter+"Example", "65520"+Delimiter+"Other \"Peer\""
+	asn1, asn2, localPref, optimizeInbound := 65510, 65520, 100, true
+
+	o := &config.Optimizer{
+		CacheSize:         15,
+		LocalPrefModifier: 20,
+		StatusSocket:      path.Join(t.TempDir(), "optimizer.sock"),
+		Db: map[string][]config.ProbeResult{
+			example: {{Time: now.UnixNano(), Stats: ping.Statistics{PacketsSent: 4, PacketsRecv: 2, Rtts: []time.Duration{10 * time.Millisecond, 30 * time.Millisecond}}}},
+			other:   {},
+		},
+		State: map[string]*config.OptimizerState{
+			example: {Degraded: true, Since: now.UnixNano()},
+		},
+	}
+	global := &config.Config{Peers: map[string]*config.Peer{
+		"Example":        {ASN: &asn1, LocalPref: &localPref, OptimizeInbound: &optimizeInbound},
+		"Other \"Peer\"": {ASN: &asn2, LocalPref: &localPref, OptimizeInbound: &optimizeInbound},
+	}}
+	updateStatus(o, global, map[string]*Metrics{example: computePeerMetrics(o.Db[example], 0, now)}, now)
+
+	assert.Nil(t, ServeStatus(o))
+	status, err := QueryStatus(o.StatusSocket, "")
+	assert.Nil(t, err)
+	assert.Equal(t, "2026-01-02T03:04:05Z", status.Updated)
+	assert.Equal(t, []PeerStatus{
+		{
+			ASN:            65510,
+			Peer:           "Example",
+			Probes:         1,
+			Latency:        20,
+			P50:            10,
+			P95:            30,
+			P99:            30,
+			Jitter:         10,
+			PacketLoss:     50,
+			CacheUsed:      1,
+			CacheSize:      15,
+			Degraded:       true,
+			LocalPref:      80,
+			LastAdjustment: "2026-01-02T03:04:05Z",
+		},
+		{
+			ASN:       65520,
+			Peer:      "Other \"Peer\"",
+			CacheSize: 15,
+			LocalPref: 100,
+		},
+	}, status.Peers)
+
+	server := httptest.NewServer(statusHandler())
+	defer server.Close()
+	status, err = QueryStatus("", server.URL)
+	assert.Nil(t, err)
+	assert.Len(t, status.Peers, 2)
+
+	metrics := prometheusMetrics(getStatus())
+	for _, line := range []string{
+		"# TYPE pathvector_optimizer_latency_seconds gauge",
+		`pathvector_optimizer_latency_seconds{asn="65510",peer="Example"} 0.02`,
+		`pathvector_optimizer_latency_quantile_seconds{asn="65510",peer="Example",quantile="0.95"} 0.03`,
+		`pathvector_optimizer_packet_loss_ratio{asn="65510",peer="Example"} 0.5`,
+		`pathvector_optimizer_degraded{asn="65510",peer="Example"} 1`,
+		`pathvector_optimizer_degraded{asn="65520",peer="Other \"Peer\""} 0`,
+		`pathvector_optimizer_local_pref{asn="65510",peer="Example"} 80`,
+		`pathvector_optimizer_cache_results{asn="65510",peer="Example"} 1`,
+		`pathvector_optimizer_last_adjustment_timestamp_seconds{asn="65510",peer="Example"} 1767323045`,
+	} {
+		assert.Contains(t, metrics, line+"\n")
+	}
+	assert.NotContains(t, metrics, `pathvector_optimizer_latency_seconds{asn="65520"`)
+}
+
+func TestOptimizerStatusSocketUnavailable(t *testing.T) {
+	// The socket directory can't be created under a file
+	file := path.Join(t.TempDir(), "file")
+	assert.Nil(t, os.WriteFile(file, []byte{}, 0644))
+	assert.Nil(t, ServeStatus(&config.Optimizer{StatusSocket: path.Join(file, "optimizer.sock")}))
+}
+
+func TestOptimizerStatusSocketInUse(t *testing.T) {
+	socket := path.Join(t.TempDir(), "optimizer.sock")
+
+	// A stale socket without a listener is replaced
+	listener, err := net.Listen("unix", socket)
+	assert.Nil(t, err)
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	assert.Nil(t, listener.Close())
+	assert.Nil(t, serveSocket(socket))
+
+	// A socket another optimizer is serving on isn't taken over
+	assert.ErrorIs(t, serveSocket(socket), errAlreadyRunning)
+	assert.ErrorIs(t, ServeStatus(&config.Optimizer{StatusSocket: socket}), errAlreadyRunning)
+}
@@ -0,0 +1,200 @@
+package optimizer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/natesales/pathvector/pkg/config"
+)
+
+// SteeringFile is the name of the file in the cache directory storing the peer each destination prefix is steered to
+const SteeringFile = "optimizer-steering.json"
+
+// LoadSteering reads the map of steered destination prefix to ASN/name peer pair from the cache directory
+func LoadSteering(cacheDirectory string) (map[string]string, error) {
+	steering := map[string]string{}
+	contents, err := os.ReadFile(path.Join(cacheDirectory, SteeringFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return steering, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(contents, &steering); err != nil {
+		return nil, fmt.Errorf("optimizer steering JSON unmarshal: %s", err)
+	}
+	return steering, nil
+}
+
+// saveSteering writes the map of steered destination prefixes to the cache directory
+func saveSteering(cacheDirectory string, steering map[string]string) error {
+	j, err := json.Marshal(steering)
+	if err != nil {
+		return err
+	}
+	//nolint:golint,gosec
+	return os.WriteFile(path.Join(cacheDirectory, SteeringFile), j, 0644)
+}
+
+// validateSteerPrefixes checks that all steered destination prefixes are valid and in canonical form
+func validateSteerPrefixes(prefixes map[string][]string) error {
+	for prefix := range prefixes {
+		_, ipNet, err := net.ParseCIDR(prefix)
+		if err != nil {
+			return fmt.Errorf("invalid steer prefix %s: %s", prefix, err)
+		}
+		if ipNet.String() != prefix {
+			return fmt.Errorf("invalid steer prefix %s: host bits set, did you mean %s?", prefix, ipNet.String())
+		}
+	}
+	return nil
+}
+
+// storeSteerResult adds a steering probe result to the probe cache, removing the oldest result if the cache is full
+func storeSteerResult(o *config.Optimizer, prefix string, peer string, result config.ProbeResult) {
+	if o.SteerDb[prefix] == nil {
+		o.SteerDb[prefix] = map[string][]config.ProbeResult{}
+	}
+	o.SteerDb[prefix][peer] = append(o.SteerDb[prefix][peer], result)
+	if len(o.SteerDb[prefix][peer]) > o.CacheSize {
+		o.SteerDb[prefix][peer] = o.SteerDb[prefix][peer][1:]
+	}
+}
+
+// steerCandidate is a peer's performance towards a destination prefix
+type steerCandidate struct {
+	peer    string
+	metrics *Metrics
+}
+
+// computeSteering selects the best performing peer for every destination prefix from the steering probe results.
+// Prefixes are only steered if at least two peers have SteerMinProbes probe runs, and the best peer has less packet
+// loss than the worst peer or improves latency by at least SteerMinImprovement. Peers that meet or exceed the packet
+// loss threshold are never selected, and if more than SteerMaxPrefixes prefixes have a best peer, only the prefixes
+// with the largest latency improvement over the worst peer are steered.
+func computeSteering(o *config.Optimizer, now time.Time) map[string]string {
+	window := time.Duration(o.Window) * time.Second
+
+	type selection struct {
+		prefix      string
+		peer        string
+		improvement time.Duration
+	}
+	var selections []selection
+
+	for prefix, peers := range o.SteerDb {
+		var candidates []steerCandidate
+		for peer, results := range peers {
+			if m := computePeerMetrics(results, window, now); m != nil && m.Probes >= o.SteerMinProbes {
+				candidates = append(candidates, steerCandidate{peer, m})
+			}
+		}
+		if len(candidates) < 2 {
+			log.Debugf("[Optimizer] %d peers to %s have enough probes to compare, not steering", len(candidates), prefix)
+			continue
+		}
+
+		// Rank by packet loss, then latency
+		sort.Slice(candidates, func(i, j int) bool {
+			a, b := candidates[i].metrics, candidates[j].metrics
+			if a.PacketLoss != b.PacketLoss {
+				return a.PacketLoss < b.PacketLoss
+			}
+			if a.Latency != b.Latency {
+				return a.Latency < b.Latency
+			}
+			return candidates[i].peer < candidates[j].peer
+		})
+		best := candidates[0]
+		if best.metrics.PacketLoss >= o.PacketLossThreshold {
+			log.Debugf("[Optimizer] No peer to %s is below the packet loss threshold, not steering", prefix)
+			continue
+		}
+		worst, worstLoss := best.metrics.Latency, best.metrics.PacketLoss
+		for _, candidate := range candidates {
+			if candidate.metrics.Latency > worst {
+				worst = candidate.metrics.Latency
+			}
+			if candidate.metrics.PacketLoss > worstLoss {
+				worstLoss = candidate.metrics.PacketLoss
+			}
+		}
+		improvement := worst - best.metrics.Latency
+		if best.metrics.PacketLoss == worstLoss && (improvement == 0 || improvement < time.Duration(o.SteerMinImprovement)*time.Millisecond) {
+			log.Debugf("[Optimizer] Best peer to %s only improves latency by %s, not steering", prefix, improvement)
+			continue
+		}
+		selections = append(selections, selection{
+			prefix:      prefix,
+			peer:        best.peer,
+			improvement: improvement,
+		})
+	}
+
+	sort.Slice(selections, func(i, j int) bool {
+		if selections[i].improvement != selections[j].improvement {
+			return selections[i].improvement > selections[j].improvement
+		}
+		return selections[i].prefix < selections[j].prefix
+	})
+	if uint(len(selections)) > o.SteerMaxPrefixes {
+		log.Warnf("[Optimizer] %d prefixes can be steered, limiting to steer-max-prefixes %d", len(selections), o.SteerMaxPrefixes)
+		selections = selections[:o.SteerMaxPrefixes]
+	}
+
+	steering := map[string]string{}
+	for _, s := range selections {
+		steering[s.prefix] = s.peer
+	}
+	return steering
+}
+
+// steeringChanged logs the differences between two steering maps and returns true if they differ
+func steeringChanged(previous, current map[string]string) bool {
+	changed := false
+	for prefix, peer := range current {
+		if previous[prefix] != peer {
+			peerASN, peerName := parsePeerDelimiter(peer)
+			log.Printf("[Optimizer] Steering %s to AS%s %s", prefix, peerASN, peerName)
+			changed = true
+		}
+	}
+	for prefix := range previous {
+		if _, found := current[prefix]; !found {
+			log.Printf("[Optimizer] No longer steering %s", prefix)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// steerFunction renders a BIRD function that raises the local pref of routes to destination prefixes steered to a peer
+func steerFunction(asn int, protocolName string, prefixes []string, modifier uint) string {
+	var prefixes4, prefixes6 []string
+	for _, prefix := range prefixes {
+		if strings.Contains(prefix, ":") {
+			prefixes6 = append(prefixes6, prefix+"+")
+		} else {
+			prefixes4 = append(prefixes4, prefix+"+")
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("function AS%d_%s_OPTIMIZER_STEER() {\n", asn, protocolName))
+	if len(prefixes4) > 0 {
+		b.WriteString(fmt.Sprintf("  if (net.type = NET_IP4 && net ~ [ %s ]) then bgp_local_pref = bgp_local_pref + %d;\n", strings.Join(prefixes4, ", "), modifier))
+	}
+	if len(prefixes6) > 0 {
+		b.WriteString(fmt.Sprintf("  if (net.type = NET_IP6 && net ~ [ %s ]) then bgp_local_pref = bgp_local_pref + %d;\n", strings.Join(prefixes6, ", "), modifier))
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
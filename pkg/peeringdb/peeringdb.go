@@ -7,6 +7,7 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"strconv"
 	"sync"
 	"time"
 
@@ -18,6 +19,9 @@ import (
 // Endpoint is a public value to allow setting to a cache server
 var Endpoint = ""
 
+// errNotFound is returned when PeeringDB has no objects for an ASN
+var errNotFound = errors.New("doesn't have a PeeringDB page")
+
 func init() {
 	// Check if running in test
 	if os.Getenv("PATHVECTOR_TEST") == "1" {
@@ -59,58 +63,140 @@ type Data struct {
 	ASSet        string `json:"irr_as_set"`
 	ImportLimit4 int    `json:"info_prefixes4"`
 	ImportLimit6 int    `json:"info_prefixes6"`
+
+	NeverViaRouteServers bool `json:"info_never_via_route_servers"`
+}
+
+// cacheEntry stores the result of a single network lookup. Failed lookups are removed from the cache after concurrent
+// lookups of the same ASN receive the error, so they can be retried.
+type cacheEntry struct {
+	wg   sync.WaitGroup
+	data *Data
+	err  error
 }
 
 var (
-	cache map[uint32]*Data
+	cache map[uint32]*cacheEntry
 	lock  sync.Mutex
 )
 
-// networkInfo returns PeeringDB for an ASN
-func networkInfo(asn uint32, queryTimeout uint, apiKey string) (*Data, error) {
-	httpClient := http.Client{Timeout: time.Second * time.Duration(queryTimeout)}
-	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf(Endpoint+"/net?asn=%d", asn), nil)
+var (
+	// MaxRetries is the number of times a rate limited (HTTP 429) or server error (HTTP 5xx) request is retried
+	MaxRetries uint = 3
 
-	if apiKey != "" {
-		req.Header.Add("AUTHORIZATION", "Api-Key "+apiKey)
-	} else if os.Getenv("PEERINGDB_API_KEY") != "" {
-		req.Header.Add("AUTHORIZATION", "Api-Key "+os.Getenv("PEERINGDB_API_KEY"))
-	}
+	// retryBackoff is the base delay before retrying a request that didn't include a Retry-After header
+	retryBackoff = time.Second
 
-	if err != nil {
-		return nil, fmt.Errorf("PeeringDB GET (This peer might not have a PeeringDB page): %s", err)
-	}
+	// maxRetryDelay is the longest delay before retrying a request, regardless of the Retry-After header
+	maxRetryDelay = time.Minute
 
-	res, err := httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("PeeringDB GET request: %s", err)
-	}
+	// workers limits the number of concurrent PeeringDB requests
+	workers     = make(chan struct{}, 4)
+	workersLock sync.Mutex
+)
 
-	if res.StatusCode == 404 {
-		return nil, fmt.Errorf("peer %d doesn't have a PeeringDB page", asn)
-	}
+// SetWorkers sets the maximum number of concurrent PeeringDB requests. Requests already in flight release their slot in
+// the previous pool.
+func SetWorkers(n uint) {
+	workersLock.Lock()
+	defer workersLock.Unlock()
+	workers = make(chan struct{}, n)
+}
 
-	if res.StatusCode != 200 {
-		return nil, errors.New("PeeringDB GET request expected 200, got " + res.Status)
+// acquireWorker waits for a slot in the worker pool and returns the pool to release it to
+func acquireWorker() chan struct{} {
+	workersLock.Lock()
+	pool := workers
+	workersLock.Unlock()
+	pool <- struct{}{}
+	return pool
+}
+
+// retryAfter returns the delay requested by a Retry-After header, or exponential backoff if not present, up to maxRetryDelay
+func retryAfter(header string, attempt uint) time.Duration {
+	delay := retryBackoff * time.Duration(1<<attempt)
+	if header != "" {
+		if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+			delay = time.Duration(seconds) * time.Second
+		} else if t, err := http.ParseTime(header); err == nil {
+			delay = time.Until(t)
+			if delay < 0 {
+				delay = 0
+			}
+		}
+	}
+	if delay > maxRetryDelay {
+		return maxRetryDelay
 	}
+	return delay
+}
+
+// query sends a GET request to PeeringDB and returns the response body and status code, retrying with backoff if rate
+// limited. The worker slot is released while waiting to retry.
+func query(url string, queryTimeout uint, apiKey string) ([]byte, int, error) {
+	httpClient := http.Client{Timeout: time.Second * time.Duration(queryTimeout)}
+	for attempt := uint(0); ; attempt++ {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			return nil, 0, fmt.Errorf("PeeringDB GET: %s", err)
+		}
 
-	if res.Body != nil {
+		if apiKey != "" {
+			req.Header.Add("AUTHORIZATION", "Api-Key "+apiKey)
+		} else if os.Getenv("PEERINGDB_API_KEY") != "" {
+			req.Header.Add("AUTHORIZATION", "Api-Key "+os.Getenv("PEERINGDB_API_KEY"))
+		}
+
+		pool := acquireWorker()
+		res, err := httpClient.Do(req)
+		if err != nil {
+			<-pool
+			return nil, 0, fmt.Errorf("PeeringDB GET request: %s", err)
+		}
+
+		body, err := io.ReadAll(res.Body)
 		//noinspection GoUnhandledErrorResult
-		defer res.Body.Close()
+		res.Body.Close()
+		<-pool
+		if err != nil {
+			return nil, res.StatusCode, fmt.Errorf("PeeringDB read: %s", err)
+		}
+
+		if res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500 {
+			if attempt < MaxRetries {
+				delay := retryAfter(res.Header.Get("Retry-After"), attempt)
+				log.Warnf("PeeringDB GET request returned %s, retrying in %s (%d/%d)", res.Status, delay, attempt+1, MaxRetries)
+				time.Sleep(delay)
+				continue
+			}
+		}
+
+		if res.StatusCode != http.StatusOK {
+			return nil, res.StatusCode, errors.New("PeeringDB GET request expected 200, got " + res.Status)
+		}
+
+		return body, res.StatusCode, nil // nil error
 	}
+}
 
-	body, err := io.ReadAll(res.Body)
+// networkInfo returns PeeringDB for an ASN
+func networkInfo(asn uint32, queryTimeout uint, apiKey string) (*Data, error) {
+	url := fmt.Sprintf(Endpoint+"/net?asn=%d", asn)
+	body, statusCode, err := query(url, queryTimeout, apiKey)
+	if statusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("peer %d %w", asn, errNotFound)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("PeeringDB read: %s", err)
+		return nil, err
 	}
 
 	var pDbResponse Response
 	if err := json.Unmarshal(body, &pDbResponse); err != nil {
-		return nil, fmt.Errorf("%s PeeringDB JSON Unmarshal: %s", req.URL, err)
+		return nil, fmt.Errorf("%s PeeringDB JSON Unmarshal: %s", url, err)
 	}
 
 	if len(pDbResponse.Data) < 1 {
-		return nil, fmt.Errorf("peer %d doesn't have a PeeringDB page", asn)
+		return nil, fmt.Errorf("peer %d %w", asn, errNotFound)
 	}
 
 	return &pDbResponse.Data[0], nil // nil error
@@ -118,24 +204,43 @@ func networkInfo(asn uint32, queryTimeout uint, apiKey string) (*Data, error) {
 
 // NetworkInfo gets the PeeringDB info for an ASN optionally from the cache
 func NetworkInfo(asn uint32, queryTimeout uint, apiKey string, useCache bool) (*Data, error) {
+	if d, synced := snapshotNetwork(asn); synced {
+		if d == nil {
+			return nil, fmt.Errorf("peer %d %w", asn, errNotFound)
+		}
+		return d, nil
+	}
+
 	if !useCache {
 		return networkInfo(asn, queryTimeout, apiKey)
+	}
+
+	// Concurrent lookups for the same ASN wait for the first one to finish
+	lock.Lock()
+	if cache == nil {
+		cache = make(map[uint32]*cacheEntry)
+	}
+	entry, ok := cache[asn]
+	if !ok {
+		entry = &cacheEntry{}
+		entry.wg.Add(1)
+		cache[asn] = entry
+	}
+	lock.Unlock()
+
+	if ok {
+		entry.wg.Wait()
 	} else {
-		lock.Lock()
-		defer lock.Unlock()
-		if cache == nil {
-			cache = make(map[uint32]*Data)
-		}
-		if _, ok := cache[asn]; !ok {
-			d, err := networkInfo(asn, queryTimeout, apiKey)
-			if err != nil {
-				return nil, err
-			}
-			cache[asn] = d
+		entry.data, entry.err = networkInfo(asn, queryTimeout, apiKey)
+		if entry.err != nil {
+			lock.Lock()
+			delete(cache, asn)
+			lock.Unlock()
 		}
-
-		return cache[asn], nil
+		entry.wg.Done()
 	}
+
+	return entry.data, entry.err
 }
 
 // Update updates peer values from PeeringDB
@@ -171,90 +276,65 @@ func Update(peerData *config.Peer, queryTimeout uint, apiKey string, useCache bo
 
 // NeverViaRouteServers gets a list of networks that report should never be reachable via route servers
 func NeverViaRouteServers(queryTimeout uint, apiKey string) ([]uint32, error) {
-	httpClient := http.Client{Timeout: time.Second * time.Duration(queryTimeout)}
-	req, err := http.NewRequest(http.MethodGet, Endpoint+"/net?info_never_via_route_servers=1", nil)
-	if err != nil {
-		return nil, fmt.Errorf("PeeringDB GET: %s", err)
-	}
-
-	if apiKey != "" {
-		req.Header.Add("AUTHORIZATION", "Api-Key "+apiKey)
-	} else {
-		if os.Getenv("PEERINGDB_API_KEY") != "" {
-			req.Header.Add("AUTHORIZATION", "Api-Key "+os.Getenv("PEERINGDB_API_KEY"))
-		}
+	if snapshot != nil {
+		return snapshotNeverViaRouteServers(), nil
 	}
 
-	res, err := httpClient.Do(req)
+	networks, err := neverViaRouteServers(queryTimeout, apiKey)
 	if err != nil {
-		return nil, fmt.Errorf("PeeringDB GET request: %s", err)
-	}
-	if res.StatusCode != 200 {
-		return nil, errors.New("PeeringDB GET request expected 200, got " + res.Status)
+		return nil, err
 	}
-	if res.Body != nil {
-		//noinspection GoUnhandledErrorResult
-		defer res.Body.Close()
+
+	var asns []uint32 // ASNs that are reportedly never reachable via route servers
+	for _, network := range networks {
+		asns = append(asns, network.ASN)
 	}
 
-	body, err := io.ReadAll(res.Body)
+	return asns, nil // nil error
+}
+
+// neverViaRouteServers queries PeeringDB for networks that report should never be reachable via route servers
+func neverViaRouteServers(queryTimeout uint, apiKey string) ([]Data, error) {
+	url := Endpoint + "/net?info_never_via_route_servers=1"
+	body, _, err := query(url, queryTimeout, apiKey)
 	if err != nil {
-		return nil, fmt.Errorf("PeeringDB read: %s", err)
+		return nil, err
 	}
 
 	var pDbResponse Response
 	if err := json.Unmarshal(body, &pDbResponse); err != nil {
-		return nil, fmt.Errorf("%s PeeringDB JSON Unmarshal: %s", req.URL, err)
+		return nil, fmt.Errorf("%s PeeringDB JSON Unmarshal: %s", url, err)
 	}
 
-	var asns []uint32 // ASNs that are reportedly never reachable via route servers
-	for _, resp := range pDbResponse.Data {
-		asns = append(asns, resp.ASN)
-	}
-
-	return asns, nil // nil error
+	return pDbResponse.Data, nil // nil error
 }
 
 // IXLANs gets PeeringDB IX LANs for an ASN
 func IXLANs(asn uint32, peeringDbQueryTimeout uint, apiKey string) ([]IxLanData, error) {
-	httpClient := http.Client{Timeout: time.Second * time.Duration(peeringDbQueryTimeout)}
-	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf(Endpoint+"/netixlan?asn=%d", asn), nil)
-	if err != nil {
-		return nil, fmt.Errorf("PeeringDB GET (This peer might not have a PeeringDB page): %s", err)
-	}
-
-	if apiKey != "" {
-		req.Header.Add("AUTHORIZATION", "Api-Key "+apiKey)
-	} else {
-		if os.Getenv("PEERINGDB_API_KEY") != "" {
-			req.Header.Add("AUTHORIZATION", "Api-Key "+os.Getenv("PEERINGDB_API_KEY"))
+	if ixLans, synced := snapshotIXLANs(asn); synced {
+		if ixLans == nil {
+			return nil, fmt.Errorf("peer %d %w or IXPs documented", asn, errNotFound)
 		}
+		return ixLans, nil
 	}
+	return ixLANs(asn, peeringDbQueryTimeout, apiKey)
+}
 
-	res, err := httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("PeeringDB GET request: %s", err)
-	}
-	if res.StatusCode != 200 {
-		return nil, errors.New("PeeringDB GET request expected 200, got " + res.Status)
-	}
-	if res.Body != nil {
-		//noinspection GoUnhandledErrorResult
-		defer res.Body.Close()
-	}
-
-	body, err := io.ReadAll(res.Body)
+// ixLANs queries PeeringDB for the IX LANs of an ASN
+func ixLANs(asn uint32, peeringDbQueryTimeout uint, apiKey string) ([]IxLanData, error) {
+	url := fmt.Sprintf(Endpoint+"/netixlan?asn=%d", asn)
+	body, _, err := query(url, peeringDbQueryTimeout, apiKey)
 	if err != nil {
-		return nil, fmt.Errorf("PeeringDB read: %s", err)
+		return nil, err
 	}
 
 	var pDbResponse IxLanResponse
 	if err := json.Unmarshal(body, &pDbResponse); err != nil {
-		return nil, fmt.Errorf("%s PeeringDB JSON Unmarshal: %s", req.URL, err)
+		return nil, fmt.Errorf("%s PeeringDB JSON Unmarshal: %s", url, err)
 	}
 
 	if len(pDbResponse.Data) < 1 {
-		return nil, fmt.Errorf("peer %d doesn't have a PeeringDB page or IXPs documented", asn)
+		return nil, fmt.Errorf("peer %d %w or IXPs documented", asn, errNotFound)
 	}
 
 	return pDbResponse.Data, nil // nil error
@@ -1,8 +1,14 @@
 package peeringdb
 
 import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -80,3 +86,189 @@ func TestPeeringNeverViaRouteServers(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, len(asns), 3)
 }
+
+func TestPeeringDbSnapshot(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/net" && r.URL.Query().Get("info_never_via_route_servers") == "1":
+			fmt.Fprint(w, `{"data": [{"asn": 65501, "name": "NVRS"}]}`)
+		case r.URL.Query().Get("asn") == "65530":
+			// Network without any PeeringDB objects
+			fmt.Fprint(w, `{"data": []}`)
+		case r.URL.Path == "/net":
+			fmt.Fprintf(w, `{"data": [{"asn": %s, "name": "Example", "irr_as_set": "AS-EXAMPLE", "info_prefixes4": 10, "info_prefixes6": 20}]}`, r.URL.Query().Get("asn"))
+		case r.URL.Path == "/netixlan":
+			fmt.Fprintf(w, `{"data": [{"asn": %s, "ix_id": 1, "ixlan_id": 1, "name": "Example IX", "ipaddr4": "192.0.2.1"}]}`, r.URL.Query().Get("asn"))
+		case r.URL.Path == "/ix":
+			assert.Equal(t, "1", r.URL.Query().Get("id__in"))
+			fmt.Fprint(w, `{"data": [{"id": 1, "name": "Example IX"}]}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	oldEndpoint := Endpoint
+	Endpoint = server.URL
+	defer func() {
+		Endpoint = oldEndpoint
+		snapshot = nil
+	}()
+
+	file := path.Join(t.TempDir(), "peeringdb.json")
+	s, err := Sync([]uint32{65510, 65530, 65520, 65510}, file, peeringDbQueryTimeout, "")
+	assert.Nil(t, err)
+	assert.Equal(t, []uint32{65510, 65520, 65530}, s.ASNs)
+	assert.Len(t, s.Networks, 3)
+	assert.Len(t, s.NetIXLANs, 2)
+	assert.Len(t, s.IXs, 1)
+
+	// Lookups must be served from the snapshot once the API is unreachable
+	server.Close()
+	assert.Nil(t, LoadSnapshot(file, 60))
+
+	network, err := NetworkInfo(65520, peeringDbQueryTimeout, "", false)
+	assert.Nil(t, err)
+	assert.Equal(t, "AS-EXAMPLE", network.ASSet)
+	assert.Equal(t, 20, network.ImportLimit6)
+
+	asns, err := NeverViaRouteServers(peeringDbQueryTimeout, "")
+	assert.Nil(t, err)
+	assert.Equal(t, []uint32{65501}, asns)
+
+	ixLans, err := IXLANs(65510, peeringDbQueryTimeout, "")
+	assert.Nil(t, err)
+	assert.Len(t, ixLans, 1)
+	assert.Equal(t, "192.0.2.1", ixLans[0].Ipaddr4)
+
+	// Synced networks without objects are resolved from the snapshot without a live query
+	_, err = NetworkInfo(65530, peeringDbQueryTimeout, "", false)
+	assert.ErrorIs(t, err, errNotFound)
+	_, err = IXLANs(65530, peeringDbQueryTimeout, "")
+	assert.ErrorIs(t, err, errNotFound)
+
+	// Networks that weren't synced fall back to a live query, which fails with the API unreachable
+	_, err = NetworkInfo(65599, peeringDbQueryTimeout, "", false)
+	assert.NotNil(t, err)
+	assert.NotErrorIs(t, err, errNotFound)
+}
+
+func TestPeeringDbRetry(t *testing.T) {
+	var requests int
+	var alwaysFail bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch {
+		case alwaysFail:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case requests == 1:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case requests == 2:
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			fmt.Fprint(w, `{"data": [{"asn": 65510, "name": "Example"}]}`)
+		}
+	}))
+	defer server.Close()
+
+	oldEndpoint, oldBackoff := Endpoint, retryBackoff
+	Endpoint, retryBackoff = server.URL, time.Millisecond
+	defer func() {
+		Endpoint, retryBackoff = oldEndpoint, oldBackoff
+	}()
+
+	network, err := NetworkInfo(65510, peeringDbQueryTimeout, "", false)
+	assert.Nil(t, err)
+	assert.Equal(t, "Example", network.Name)
+	assert.Equal(t, 3, requests)
+
+	// Give up after MaxRetries
+	requests, alwaysFail = 0, true
+	_, err = NetworkInfo(65510, peeringDbQueryTimeout, "", false)
+	assert.NotNil(t, err)
+	assert.Equal(t, int(MaxRetries)+1, requests)
+}
+
+func TestPeeringDbWorkers(t *testing.T) {
+	var lock sync.Mutex
+	limited := make(chan struct{})
+	rateLimited := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		if r.URL.Query().Get("asn") == "65510" && !rateLimited {
+			rateLimited = true
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			close(limited)
+			return
+		}
+		fmt.Fprintf(w, `{"data": [{"asn": %s, "name": "Example"}]}`, r.URL.Query().Get("asn"))
+	}))
+	defer server.Close()
+
+	oldEndpoint := Endpoint
+	Endpoint = server.URL
+	SetWorkers(1)
+	defer func() {
+		Endpoint = oldEndpoint
+		SetWorkers(4)
+	}()
+
+	done := make(chan error)
+	go func() {
+		_, err := NetworkInfo(65510, peeringDbQueryTimeout, "", false)
+		done <- err
+	}()
+
+	// The only worker slot is released while the rate limited request waits to retry
+	<-limited
+	start := time.Now()
+	network, err := NetworkInfo(65520, peeringDbQueryTimeout, "", false)
+	assert.Nil(t, err)
+	assert.Equal(t, "Example", network.Name)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	assert.Nil(t, <-done)
+
+	// Slots acquired before the pool is resized are released to the previous pool
+	pool := acquireWorker()
+	SetWorkers(1)
+	<-pool
+	<-acquireWorker()
+}
+
+func TestPeeringDbCacheFailure(t *testing.T) {
+	fail := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprint(w, `{"data": [{"asn": 65530, "name": "Example"}]}`)
+	}))
+	defer server.Close()
+
+	oldEndpoint := Endpoint
+	Endpoint = server.URL
+	defer func() {
+		Endpoint = oldEndpoint
+	}()
+
+	_, err := NetworkInfo(65530, peeringDbQueryTimeout, "", true)
+	assert.NotNil(t, err)
+
+	// Failed lookups aren't cached
+	fail = false
+	network, err := NetworkInfo(65530, peeringDbQueryTimeout, "", true)
+	assert.Nil(t, err)
+	assert.Equal(t, "Example", network.Name)
+}
+
+func TestRetryAfter(t *testing.T) {
+	assert.Equal(t, 5*time.Second, retryAfter("5", 0))
+	assert.Equal(t, retryBackoff, retryAfter("", 0))
+	assert.Equal(t, 4*retryBackoff, retryAfter("", 2))
+	assert.Equal(t, time.Duration(0), retryAfter(time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat), 0))
+	assert.Equal(t, maxRetryDelay, retryAfter("86400", 0))
+	assert.Equal(t, maxRetryDelay, retryAfter(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat), 0))
+}
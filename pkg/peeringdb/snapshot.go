@@ -0,0 +1,212 @@
+package peeringdb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type IxResponse struct {
+	Data []IxData `json:"data"`
+}
+
+type IxData struct {
+	Id      int    `json:"id"`
+	Name    string `json:"name"`
+	City    string `json:"city"`
+	Country string `json:"country"`
+	Website string `json:"website"`
+}
+
+// Snapshot stores a local copy of the PeeringDB objects required to generate configuration
+type Snapshot struct {
+	Updated   time.Time   `json:"updated"`
+	ASNs      []uint32    `json:"asns"`
+	Networks  []Data      `json:"net"`
+	NetIXLANs []IxLanData `json:"netixlan"`
+	IXs       []IxData    `json:"ix"`
+}
+
+// snapshot is the currently loaded snapshot, or nil if lookups should be resolved against the live API
+var snapshot *Snapshot
+
+// ixInfo queries PeeringDB for a list of IXs by ID
+func ixInfo(ids []int, queryTimeout uint, apiKey string) ([]IxData, error) {
+	var idStrings []string
+	for _, id := range ids {
+		idStrings = append(idStrings, fmt.Sprintf("%d", id))
+	}
+
+	url := Endpoint + "/ix?id__in=" + strings.Join(idStrings, ",")
+	body, _, err := query(url, queryTimeout, apiKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var pDbResponse IxResponse
+	if err := json.Unmarshal(body, &pDbResponse); err != nil {
+		return nil, fmt.Errorf("%s PeeringDB JSON Unmarshal: %s", url, err)
+	}
+
+	return pDbResponse.Data, nil // nil error
+}
+
+// Sync downloads the net, netixlan and ix objects for a list of ASNs, as well as all networks that are never via route servers, and writes them to a snapshot file
+func Sync(asns []uint32, file string, queryTimeout uint, apiKey string) (*Snapshot, error) {
+	s := &Snapshot{Updated: time.Now().UTC()}
+
+	// Deduplicate and sort ASNs so the snapshot is stable across runs
+	seen := map[uint32]bool{}
+	var uniqueASNs []uint32
+	for _, asn := range asns {
+		if !seen[asn] {
+			seen[asn] = true
+			uniqueASNs = append(uniqueASNs, asn)
+		}
+	}
+	sort.Slice(uniqueASNs, func(i, j int) bool { return uniqueASNs[i] < uniqueASNs[j] })
+
+	nvrs, err := neverViaRouteServers(queryTimeout, apiKey)
+	if err != nil {
+		return nil, fmt.Errorf("NVRS query: %s", err)
+	}
+	for i := range nvrs {
+		nvrs[i].NeverViaRouteServers = true
+	}
+	s.Networks = append(s.Networks, nvrs...)
+
+	ixIDs := map[int]bool{}
+	for _, asn := range uniqueASNs {
+		log.Debugf("Syncing PeeringDB objects for AS%d", asn)
+		network, err := networkInfo(asn, queryTimeout, apiKey)
+		if err != nil {
+			log.Warnf("AS%d: %s", asn, err)
+		} else if !network.NeverViaRouteServers {
+			s.Networks = append(s.Networks, *network)
+		}
+		networkSynced := err == nil || errors.Is(err, errNotFound)
+
+		ixLans, err := ixLANs(asn, queryTimeout, apiKey)
+		if err != nil {
+			log.Debugf("AS%d: %s", asn, err)
+		}
+		s.NetIXLANs = append(s.NetIXLANs, ixLans...)
+		for _, ixLan := range ixLans {
+			ixIDs[ixLan.IxId] = true
+		}
+
+		// Only ASNs that PeeringDB answered for are resolved from the snapshot, others fall back to live queries
+		if networkSynced && (err == nil || errors.Is(err, errNotFound)) {
+			s.ASNs = append(s.ASNs, asn)
+		}
+	}
+
+	if len(ixIDs) > 0 {
+		var ids []int
+		for id := range ixIDs {
+			ids = append(ids, id)
+		}
+		sort.Ints(ids)
+		s.IXs, err = ixInfo(ids, queryTimeout, apiKey)
+		if err != nil {
+			return nil, fmt.Errorf("IX query: %s", err)
+		}
+	}
+
+	j, err := json.Marshal(s)
+	if err != nil {
+		return nil, fmt.Errorf("marshalling PeeringDB snapshot: %s", err)
+	}
+	//nolint:golint,gosec
+	if err := os.WriteFile(file, j, 0644); err != nil {
+		return nil, fmt.Errorf("writing PeeringDB snapshot: %s", err)
+	}
+
+	return s, nil // nil error
+}
+
+// LoadSnapshot reads a snapshot file and resolves all subsequent PeeringDB lookups from it, warning if it is older than maxAge seconds
+func LoadSnapshot(file string, maxAge uint) error {
+	contents, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("reading PeeringDB snapshot: %s", err)
+	}
+
+	var s Snapshot
+	if err := json.Unmarshal(contents, &s); err != nil {
+		return fmt.Errorf("PeeringDB snapshot JSON Unmarshal: %s", err)
+	}
+
+	age := time.Since(s.Updated)
+	if maxAge > 0 && age > time.Duration(maxAge)*time.Second {
+		log.Warnf("PeeringDB snapshot %s is %s old, exceeding the maximum age of %s. Run pathvector peeringdb sync to update it.",
+			file, age.Round(time.Second), time.Duration(maxAge)*time.Second)
+	}
+
+	log.Debugf("Loaded PeeringDB snapshot from %s (%d networks, %d netixlans, %d IXs)", file, len(s.Networks), len(s.NetIXLANs), len(s.IXs))
+	snapshot = &s
+	return nil
+}
+
+// snapshotSynced returns true if an ASN's objects were downloaded to the loaded snapshot
+func snapshotSynced(asn uint32) bool {
+	for _, synced := range snapshot.ASNs {
+		if synced == asn {
+			return true
+		}
+	}
+	return false
+}
+
+// snapshotNetwork returns a network from the snapshot and true if the snapshot has the ASN's objects. The network is
+// nil if the ASN was synced but doesn't have a PeeringDB page.
+func snapshotNetwork(asn uint32) (*Data, bool) {
+	if snapshot == nil {
+		return nil, false
+	}
+	for i := range snapshot.Networks {
+		if snapshot.Networks[i].ASN == asn {
+			return &snapshot.Networks[i], true
+		}
+	}
+	if snapshotSynced(asn) {
+		return nil, true
+	}
+	log.Warnf("AS%d not found in PeeringDB snapshot, falling back to live query", asn)
+	return nil, false
+}
+
+// snapshotNeverViaRouteServers returns the ASNs of NVRS networks in the snapshot
+func snapshotNeverViaRouteServers() []uint32 {
+	var asns []uint32
+	for _, network := range snapshot.Networks {
+		if network.NeverViaRouteServers {
+			asns = append(asns, network.ASN)
+		}
+	}
+	return asns
+}
+
+// snapshotIXLANs returns the IX LANs of an ASN from the snapshot and true if the snapshot has the ASN's objects
+func snapshotIXLANs(asn uint32) ([]IxLanData, bool) {
+	if snapshot == nil {
+		return nil, false
+	}
+	var ixLans []IxLanData
+	for _, ixLan := range snapshot.NetIXLANs {
+		if ixLan.Asn == asn {
+			ixLans = append(ixLans, ixLan)
+		}
+	}
+	if ixLans == nil && !snapshotSynced(asn) {
+		log.Warnf("AS%d not found in PeeringDB snapshot, falling back to live query", asn)
+		return nil, false
+	}
+	return ixLans, true
+}
@@ -0,0 +1,91 @@
+package process
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/creasty/defaults"
+
+	"github.com/natesales/pathvector/pkg/config"
+	"github.com/natesales/pathvector/pkg/healthcheck"
+	"github.com/natesales/pathvector/pkg/util"
+)
+
+// anycastProtocolName returns the name of the static protocol of an anycast prefix
+func anycastProtocolName(prefix string) string {
+	return "ANYCAST_" + strings.ToUpper(strings.NewReplacer(".", "_", ":", "_", "/", "_").Replace(prefix))
+}
+
+// parseAnycast validates anycast health checks and adds anycast prefixes to the originated prefixes in sorted order
+func parseAnycast(c *config.Config) error {
+	prefixes := make([]string, 0, len(c.Anycast))
+	for prefix := range c.Anycast {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+
+	for _, prefix := range prefixes {
+		hc := c.Anycast[prefix]
+		_, ipNet, err := net.ParseCIDR(prefix)
+		if err != nil {
+			return fmt.Errorf("invalid anycast prefix %s: %s", prefix, err)
+		}
+		if ipNet.String() != prefix {
+			return fmt.Errorf("invalid anycast prefix %s: host bits set, did you mean %s?", prefix, ipNet.String())
+		}
+		if util.Contains(c.Prefixes, prefix) {
+			return fmt.Errorf("[%s] anycast prefixes must not also be in prefixes", prefix)
+		}
+		if hc == nil {
+			return fmt.Errorf("[%s] anycast prefix has no health check", prefix)
+		}
+		defaults.MustSet(hc)
+
+		switch hc.Type {
+		case healthcheck.TypeTCP:
+			if _, _, err := net.SplitHostPort(hc.Target); err != nil {
+				return fmt.Errorf("[%s] invalid tcp health check target %s: %s", prefix, hc.Target, err)
+			}
+		case healthcheck.TypeHTTP:
+			u, err := url.Parse(hc.Target)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				return fmt.Errorf("[%s] invalid http health check target %s", prefix, hc.Target)
+			}
+		case healthcheck.TypeCommand:
+			if hc.Target == "" {
+				return fmt.Errorf("[%s] command health check requires a target command", prefix)
+			}
+		default:
+			return fmt.Errorf("[%s] invalid health check type %q (must be one of tcp, http, command)", prefix, hc.Type)
+		}
+		if hc.DampeningReuse > hc.DampeningSuppress {
+			return fmt.Errorf("[%s] dampening-reuse must not be greater than dampening-suppress", prefix)
+		}
+		if options := c.PrefixOptions[prefix]; options != nil && options.IfRoute != "" {
+			return fmt.Errorf("[%s] anycast prefixes can't have an if-route", prefix)
+		}
+
+		hc.ProtocolName = anycastProtocolName(prefix)
+		if ipNet.IP.To4() == nil {
+			c.Prefixes6 = append(c.Prefixes6, prefix)
+		} else {
+			c.Prefixes4 = append(c.Prefixes4, prefix)
+		}
+	}
+	return nil
+}
+
+// loadAnycastState sets the announcement state of anycast prefixes from the health check state in the cache directory
+func loadAnycastState(c *config.Config) error {
+	state, err := healthcheck.LoadState(c.CacheDirectory)
+	if err != nil {
+		return err
+	}
+	for prefix, hc := range c.Anycast {
+		hc.Announced = state[prefix]
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package process
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/natesales/pathvector/pkg/healthcheck"
+)
+
+func TestAnycast(t *testing.T) {
+	c, err := Load([]byte(`
+asn: 34553
+router-id: 192.0.2.1
+prefixes: [ 198.51.100.0/24 ]
+anycast:
+  192.0.2.0/24:
+    type: tcp
+    target: 192.0.2.53:53
+  2001:db8:53::/48:
+    type: http
+    target: http://[2001:db8:53::1]/health
+    rise: 1
+prefix-options:
+  192.0.2.0/24:
+    prepends: 1
+`))
+	assert.Nil(t, err)
+
+	hc := c.Anycast["192.0.2.0/24"]
+	assert.Equal(t, "ANYCAST_192_0_2_0_24", hc.ProtocolName)
+	assert.Equal(t, uint(5), hc.Interval)
+	assert.Equal(t, uint(3), hc.Rise)
+	assert.Equal(t, uint(1), c.Anycast["2001:db8:53::/48"].Rise)
+	assert.Equal(t, []string{"198.51.100.0/24", "192.0.2.0/24"}, c.Prefixes4)
+	assert.Equal(t, []string{"2001:db8:53::/48"}, c.Prefixes6)
+
+	c.CacheDirectory = t.TempDir()
+	assert.Nil(t, os.WriteFile(path.Join(c.CacheDirectory, healthcheck.StateFile), []byte(`{"192.0.2.0/24": true}`), 0644))
+	assert.Nil(t, loadAnycastState(c))
+	assert.True(t, hc.Announced)
+	assert.False(t, c.Anycast["2001:db8:53::/48"].Announced)
+
+	global := renderTest(t, c)["bird.conf"]
+	assert.Contains(t, global, "protocol static ANYCAST_192_0_2_0_24 {\n  ipv4;\n  route 192.0.2.0/24 reject;\n}")
+	assert.Contains(t, global, "protocol static ANYCAST_2001_DB8_53___48 {\n  disabled;\n  ipv6;\n  route 2001:db8:53::/48 reject;\n}")
+	assert.Contains(t, global, "route 198.51.100.0/24 reject;")
+	assert.Contains(t, global, "if (net = 192.0.2.0/24 && proto = \"ANYCAST_192_0_2_0_24\") then {")
+	assert.NotContains(t, global, "route 192.0.2.0/24 reject;\n  route")
+}
+
+func TestAnycastOrder(t *testing.T) {
+	c, err := Load([]byte(`
+asn: 34553
+router-id: 192.0.2.1
+anycast:
+  203.0.113.0/24:
+    type: command
+    target: "true"
+  192.0.2.0/24:
+    type: command
+    target: "true"
+  2001:db8:2::/48:
+    type: command
+    target: "true"
+  2001:db8:1::/48:
+    type: command
+    target: "true"
+`))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"192.0.2.0/24", "203.0.113.0/24"}, c.Prefixes4)
+	assert.Equal(t, []string{"2001:db8:1::/48", "2001:db8:2::/48"}, c.Prefixes6)
+}
+
+func TestAnycastInvalid(t *testing.T) {
+	testLoadErrors(t, `
+asn: 34553
+router-id: 192.0.2.1
+prefixes: [ 198.51.100.0/24 ]
+anycast:
+  `, []loadErrorTest{
+		{"host bits", "192.0.2.1/24: { type: tcp, target: \"192.0.2.1:53\" }", "host bits set"},
+		{"also in prefixes", "198.51.100.0/24: { type: tcp, target: \"192.0.2.1:53\" }", "must not also be in prefixes"},
+		{"invalid type", "192.0.2.0/24: { type: icmp, target: 192.0.2.1 }", "invalid health check type"},
+		{"invalid tcp target", "192.0.2.0/24: { type: tcp, target: 192.0.2.1 }", "invalid tcp health check target"},
+		{"invalid http target", "192.0.2.0/24: { type: http, target: \"192.0.2.1:80\" }", "invalid http health check target"},
+		{"invalid dampening", "192.0.2.0/24: { type: command, target: \"true\", dampening-reuse: 5000 }", "dampening-reuse must not be greater"},
+	})
+}
@@ -0,0 +1,168 @@
+package process
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/natesales/pathvector/pkg/config"
+	"github.com/natesales/pathvector/pkg/util"
+)
+
+// BlackholeFile is the name of the file in the cache directory storing blackhole requests
+const BlackholeFile = "blackholes.json"
+
+// BlackholeRequest is a prefix to originate with the blackhole community until it expires
+type BlackholeRequest struct {
+	Peers   []string  `json:"peers"`
+	Expires time.Time `json:"expires"`
+}
+
+// blackholeApplies checks if a blackhole request is announced to a peer, requests without peers are announced to all peers
+func blackholeApplies(request *BlackholeRequest, peerName string, peerData *config.Peer) bool {
+	if len(request.Peers) == 0 {
+		return true
+	}
+	for _, selector := range request.Peers {
+		if peerSelectorApplies(selector, peerName, peerData) {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadBlackholes reads the blackhole requests from the cache directory
+func LoadBlackholes(cacheDirectory string) (map[string]*BlackholeRequest, error) {
+	requests := map[string]*BlackholeRequest{}
+	contents, err := os.ReadFile(path.Join(cacheDirectory, BlackholeFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return requests, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(contents, &requests); err != nil {
+		return nil, fmt.Errorf("blackhole requests JSON unmarshal: %s", err)
+	}
+	return requests, nil
+}
+
+// saveBlackholes writes the blackhole requests to the cache directory
+func saveBlackholes(cacheDirectory string, requests map[string]*BlackholeRequest) error {
+	j, err := json.Marshal(requests)
+	if err != nil {
+		return err
+	}
+	//nolint:golint,gosec
+	return os.WriteFile(path.Join(cacheDirectory, BlackholeFile), j, 0644)
+}
+
+// AddBlackhole stores a blackhole request for a prefix that expires after a TTL, replacing any existing request for the prefix
+func AddBlackhole(c *config.Config, prefix string, peers []string, ttl time.Duration) error {
+	_, ipNet, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return fmt.Errorf("invalid blackhole prefix %s: %s", prefix, err)
+	}
+	if ipNet.String() != prefix {
+		return fmt.Errorf("invalid blackhole prefix %s: host bits set, did you mean %s?", prefix, ipNet.String())
+	}
+
+	request := &BlackholeRequest{Peers: peers, Expires: time.Now().Add(ttl)}
+	matched := 0
+	for peerName, peerData := range c.Peers {
+		if blackholeApplies(request, peerName, peerData) {
+			matched++
+		}
+	}
+	if matched == 0 {
+		return fmt.Errorf("no peers match %s", strings.Join(peers, ", "))
+	}
+
+	if err := os.MkdirAll(c.CacheDirectory, os.FileMode(0755)); err != nil {
+		return err
+	}
+	requests, err := LoadBlackholes(c.CacheDirectory)
+	if err != nil {
+		return err
+	}
+	requests[prefix] = request
+	return saveBlackholes(c.CacheDirectory, requests)
+}
+
+// RemoveBlackhole removes a blackhole request
+func RemoveBlackhole(cacheDirectory, prefix string) error {
+	requests, err := LoadBlackholes(cacheDirectory)
+	if err != nil {
+		return err
+	}
+	if _, found := requests[prefix]; !found {
+		return fmt.Errorf("blackhole request for %s not found", prefix)
+	}
+	delete(requests, prefix)
+	return saveBlackholes(cacheDirectory, requests)
+}
+
+// ExpireBlackholes removes expired blackhole requests from the cache directory and returns the number of requests removed
+func ExpireBlackholes(cacheDirectory string, now time.Time) (int, error) {
+	requests, err := LoadBlackholes(cacheDirectory)
+	if err != nil {
+		return 0, err
+	}
+	expired := 0
+	for prefix, request := range requests {
+		if !now.Before(request.Expires) {
+			log.Infof("Withdrawing expired blackhole request for %s", prefix)
+			delete(requests, prefix)
+			expired++
+		}
+	}
+	if expired > 0 {
+		return expired, saveBlackholes(cacheDirectory, requests)
+	}
+	return 0, nil
+}
+
+// mergeBlackholes removes expired blackhole requests and adds the remaining requests to the global and peer configs
+func mergeBlackholes(c *config.Config, now time.Time) error {
+	if _, err := ExpireBlackholes(c.CacheDirectory, now); err != nil {
+		return err
+	}
+	requests, err := LoadBlackholes(c.CacheDirectory)
+	if err != nil {
+		return err
+	}
+
+	prefixes := make([]string, 0, len(requests))
+	for prefix := range requests {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+
+	for _, prefix := range prefixes {
+		v6 := strings.Contains(prefix, ":")
+		if v6 {
+			c.Blackholes6 = append(c.Blackholes6, prefix)
+		} else {
+			c.Blackholes4 = append(c.Blackholes4, prefix)
+		}
+
+		for peerName, peerData := range c.Peers {
+			if !blackholeApplies(requests[prefix], peerName, peerData) {
+				continue
+			}
+			if v6 {
+				peerData.Blackholes6 = util.Ptr(append(util.Deref(peerData.Blackholes6), prefix))
+			} else {
+				peerData.Blackholes4 = util.Ptr(append(util.Deref(peerData.Blackholes4), prefix))
+			}
+		}
+	}
+	return nil
+}
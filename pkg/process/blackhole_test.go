@@ -0,0 +1,65 @@
+package process
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlackholes(t *testing.T) {
+	c, err := Load([]byte(`
+asn: 34553
+router-id: 192.0.2.1
+peers:
+  Upstream:
+    asn: 65510
+    tags: [ transit ]
+    neighbors: [ 203.0.113.1, 2001:db8::1 ]
+  Peer:
+    asn: 65520
+    add-on-export: [ "65520:666" ]
+    export-next-hop: self
+    neighbors: [ 203.0.113.2, 2001:db8::2 ]
+`))
+	assert.Nil(t, err)
+	c.CacheDirectory = t.TempDir()
+
+	assert.ErrorContains(t, AddBlackhole(c, "192.0.2.10/24", nil, time.Hour), "host bits set")
+	assert.ErrorContains(t, AddBlackhole(c, "192.0.2.10/32", []string{"tag:ix"}, time.Hour), "no peers match tag:ix")
+	assert.Nil(t, AddBlackhole(c, "192.0.2.10/32", []string{"tag:transit"}, time.Hour))
+	assert.Nil(t, AddBlackhole(c, "2001:db8::10/128", nil, time.Hour))
+	assert.Nil(t, AddBlackhole(c, "192.0.2.11/32", []string{"asn:65520"}, time.Minute))
+	assert.Nil(t, AddBlackhole(c, "192.0.2.12/32", []string{"Peer"}, time.Hour))
+	assert.Nil(t, RemoveBlackhole(c.CacheDirectory, "192.0.2.12/32"))
+	assert.ErrorContains(t, RemoveBlackhole(c.CacheDirectory, "192.0.2.12/32"), "not found")
+
+	// 192.0.2.11/32 expires
+	assert.Nil(t, mergeBlackholes(c, time.Now().Add(10*time.Minute)))
+	assert.Equal(t, []string{"192.0.2.10/32"}, c.Blackholes4)
+	assert.Equal(t, []string{"2001:db8::10/128"}, c.Blackholes6)
+	assert.Equal(t, []string{"192.0.2.10/32"}, *c.Peers["Upstream"].Blackholes4)
+	assert.Equal(t, []string{"2001:db8::10/128"}, *c.Peers["Upstream"].Blackholes6)
+	assert.Nil(t, c.Peers["Peer"].Blackholes4)
+	assert.Equal(t, []string{"2001:db8::10/128"}, *c.Peers["Peer"].Blackholes6)
+
+	requests, err := LoadBlackholes(c.CacheDirectory)
+	assert.Nil(t, err)
+	assert.Len(t, requests, 2)
+
+	output := renderTest(t, c)
+	assert.Contains(t, output["bird.conf"], "route 192.0.2.10/32 blackhole { bgp_community.add((65535,666)); };")
+	assert.Contains(t, output["bird.conf"], "route 2001:db8::10/128 blackhole { bgp_community.add((65535,666)); };")
+	assert.Contains(t, output["AS65520_PEER.conf"], "if (proto = \"blackhole4\") then {")
+	assert.Contains(t, output["AS65520_PEER.conf"], "  2001:db8::10/128\n\n                ]) then {\n                    # Blackhole requests skip the export filter")
+	assert.Contains(t, output["AS65520_PEER.conf"], "bgp_community.add((65520,666));\n                    bgp_next_hop = self;\n                    accept;")
+	assert.NotContains(t, output["AS65520_PEER.conf"], "192.0.2.10/32")
+
+	// Expiring all requests
+	expired, err := ExpireBlackholes(c.CacheDirectory, time.Now().Add(2*time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, expired)
+	requests, err = LoadBlackholes(c.CacheDirectory)
+	assert.Nil(t, err)
+	assert.Empty(t, requests)
+}
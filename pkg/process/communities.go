@@ -0,0 +1,189 @@
+package process
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/natesales/pathvector/pkg/config"
+	"github.com/natesales/pathvector/pkg/util"
+)
+
+// peerASNPlaceholder is replaced with the ASN of the peer being exported to in action communities
+const peerASNPlaceholder = "peer-asn"
+
+// sortedActionCommunities returns the action communities of a config in sorted order
+func sortedActionCommunities(c *config.Config) []string {
+	communities := make([]string, 0, len(c.ActionCommunities))
+	for community := range c.ActionCommunities {
+		communities = append(communities, community)
+	}
+	sort.Strings(communities)
+	return communities
+}
+
+// validateActionCommunities checks that all action communities are valid and take at least one action
+func validateActionCommunities(c *config.Config) error {
+	for _, community := range sortedActionCommunities(c) {
+		action := c.ActionCommunities[community]
+		if action == nil || (action.Prepend == 0 && !action.NoExport && action.LocalPref == 0) {
+			return fmt.Errorf("action community %s has no action", community)
+		}
+		if action.NoExport && (action.Prepend != 0 || action.LocalPref != 0) {
+			return fmt.Errorf("action community %s has no-export set with another action", community)
+		}
+		if categorizeCommunity(strings.ReplaceAll(community, peerASNPlaceholder, "0")) == "" {
+			return errors.New("Invalid action community: " + community)
+		}
+		for _, peerName := range action.Peers {
+			if _, found := c.Peers[peerName]; !found {
+				return fmt.Errorf("action community %s references unknown peer %s", community, peerName)
+			}
+		}
+	}
+
+	if c.ActionCommunitiesCustomersOnly && len(c.ActionCommunities) > 0 {
+		for _, peerData := range c.Peers {
+			if util.Deref(peerData.Relationship) == relationshipCustomer {
+				return nil
+			}
+		}
+		return errors.New("action-communities-customers-only is set but no peers have relationship customer")
+	}
+	return nil
+}
+
+// actionApplies returns if an action community applies to a peer
+func actionApplies(action *config.ActionCommunity, peerName string, peerData *config.Peer) bool {
+	if len(action.Peers) == 0 && len(action.Tags) == 0 && len(action.ASNs) == 0 {
+		return true
+	}
+	for _, name := range action.Peers {
+		if name == peerName {
+			return true
+		}
+	}
+	for _, asn := range action.ASNs {
+		if int(asn) == *peerData.ASN {
+			return true
+		}
+	}
+	if peerData.Tags != nil {
+		for _, tag := range action.Tags {
+			for _, peerTag := range *peerData.Tags {
+				if tag == peerTag {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// exportActions resolves the action communities that apply to a peer
+func exportActions(c *config.Config, peerName string, peerData *config.Peer) []config.ExportAction {
+	actions := []config.ExportAction{}
+	for _, community := range sortedActionCommunities(c) {
+		action := c.ActionCommunities[community]
+		if !actionApplies(action, peerName, peerData) {
+			continue
+		}
+
+		community = strings.ReplaceAll(community, peerASNPlaceholder, strconv.Itoa(*peerData.ASN))
+		community = strings.ReplaceAll(community, ":", ",")
+		communityType := categorizeCommunity(community)
+		if communityType == "" {
+			// Standard communities can't match 32-bit peer ASNs
+			continue
+		}
+
+		// Local pref is only carried over iBGP
+		var localPref uint
+		if internalPeer(c, peerData) {
+			localPref = action.LocalPref
+		}
+		if action.Prepend == 0 && !action.NoExport && localPref == 0 {
+			continue
+		}
+
+		exportAction := config.ExportAction{
+			Community: community,
+			Large:     communityType == "large",
+			Prepend:   util.Ptr(int(action.Prepend)),
+			NoExport:  action.NoExport,
+			LocalPref: localPref,
+		}
+		if c.ActionCommunitiesCustomersOnly {
+			exportAction.CustomerCommunity = fmt.Sprintf("%d,%d,%d", c.ASN, c.RelationshipFunction, relationshipIDs[relationshipCustomer])
+		}
+		actions = append(actions, exportAction)
+	}
+	return actions
+}
+
+// describeAction returns a human readable description of an action
+func describeAction(action *config.ActionCommunity) string {
+	var parts []string
+	if action.NoExport {
+		parts = append(parts, "Don't announce")
+	}
+	if action.Prepend == 1 {
+		parts = append(parts, "Prepend 1x")
+	} else if action.Prepend > 1 {
+		parts = append(parts, fmt.Sprintf("Prepend %dx", action.Prepend))
+	}
+	if action.LocalPref != 0 {
+		parts = append(parts, fmt.Sprintf("Set local pref to %d internally", action.LocalPref))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// ActionCommunityDocs renders customer documentation of the action communities as Markdown
+func ActionCommunityDocs(c *config.Config) string {
+	var peerNames []string
+	for peerName := range c.Peers {
+		peerNames = append(peerNames, peerName)
+	}
+	sort.Strings(peerNames)
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("# AS%d Action Communities\n\n", c.ASN))
+	if len(c.ActionCommunities) == 0 {
+		b.WriteString("No action communities are configured.\n")
+		return b.String()
+	}
+	b.WriteString(fmt.Sprintf("Tag routes announced to AS%d with the following communities to control how they are announced to our peers.", c.ASN))
+	if strings.Contains(strings.Join(sortedActionCommunities(c), " "), peerASNPlaceholder) {
+		b.WriteString(" Replace `peer-asn` with the ASN of the peer the action should apply to.")
+	}
+	b.WriteString("\n\n| Community | Action | Applies To | Description |\n|-----------|--------|------------|-------------|\n")
+
+	for _, community := range sortedActionCommunities(c) {
+		action := c.ActionCommunities[community]
+
+		// Summarize the peers the action applies to
+		appliesTo := "All peers"
+		if len(action.Peers) > 0 || len(action.Tags) > 0 || len(action.ASNs) > 0 {
+			seen := map[string]bool{}
+			var targets []string
+			for _, peerName := range peerNames {
+				peerData := c.Peers[peerName]
+				target := fmt.Sprintf("AS%d", *peerData.ASN)
+				if !seen[target] && actionApplies(action, peerName, peerData) {
+					seen[target] = true
+					targets = append(targets, target)
+				}
+			}
+			appliesTo = strings.Join(targets, ", ")
+			if appliesTo == "" {
+				appliesTo = "None"
+			}
+		}
+
+		b.WriteString(fmt.Sprintf("| `%s` | %s | %s | %s |\n",
+			strings.ReplaceAll(community, ",", ":"), describeAction(action), appliesTo, action.Description))
+	}
+	return b.String()
+}
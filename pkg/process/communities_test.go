@@ -0,0 +1,136 @@
+package process
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/natesales/pathvector/pkg/config"
+	"github.com/natesales/pathvector/pkg/util"
+)
+
+const actionCommunitiesConfig = `
+asn: 34553
+router-id: 192.0.2.1
+action-communities:
+  "34553:101:peer-asn":
+    prepend: 1
+    tags: [ upstream ]
+    description: Prepend once to an upstream
+  "34553:103:peer-asn":
+    prepend: 3
+    tags: [ upstream ]
+  "34553:200:peer-asn":
+    no-export: true
+  "34553:300:1":
+    no-export: true
+    tags: [ ix ]
+    description: Don't announce to IX peers
+  "65535:80":
+    local-pref: 80
+    peers: [ Internal, Cogent ]
+peers:
+  Cogent:
+    asn: 174
+    tags: [ upstream ]
+    neighbors: [ 192.0.2.10 ]
+  IX Peer:
+    asn: 4200000000
+    tags: [ ix ]
+    neighbors: [ 192.0.2.11 ]
+  Internal:
+    asn: 34553
+    neighbors: [ 192.0.2.12 ]
+`
+
+func TestActionCommunities(t *testing.T) {
+	c, err := Load([]byte(actionCommunitiesConfig))
+	assert.Nil(t, err)
+
+	assert.Equal(t, []config.ExportAction{
+		{Community: "34553,101,174", Large: true, Prepend: util.Ptr(1)},
+		{Community: "34553,103,174", Large: true, Prepend: util.Ptr(3)},
+		{Community: "34553,200,174", Large: true, Prepend: util.Ptr(0), NoExport: true},
+	}, *c.Peers["Cogent"].ExportActions)
+	assert.Equal(t, []config.ExportAction{
+		{Community: "34553,200,4200000000", Large: true, Prepend: util.Ptr(0), NoExport: true},
+		{Community: "34553,300,1", Large: true, Prepend: util.Ptr(0), NoExport: true},
+	}, *c.Peers["IX Peer"].ExportActions)
+	assert.Equal(t, []config.ExportAction{
+		{Community: "34553,200,34553", Large: true, Prepend: util.Ptr(0), NoExport: true},
+		{Community: "65535,80", Prepend: util.Ptr(0), LocalPref: 80},
+	}, *c.Peers["Internal"].ExportActions)
+
+	files := renderTest(t, c)
+	assert.Contains(t, files["AS34553_INTERNAL.conf"], "bgp_local_pref = 80;")
+	assert.NotContains(t, files["AS174_COGENT.conf"], "bgp_local_pref = 80;")
+
+	assert.Equal(t, `# AS34553 Action Communities
+
+Tag routes announced to AS34553 with the following communities to control how they are announced to our peers. Replace `+"`peer-asn`"+` with the ASN of the peer the action should apply to.
+
+| Community | Action | Applies To | Description |
+|-----------|--------|------------|-------------|
+| `+"`34553:101:peer-asn`"+` | Prepend 1x | AS174 | Prepend once to an upstream |
+| `+"`34553:103:peer-asn`"+` | Prepend 3x | AS174 |  |
+| `+"`34553:200:peer-asn`"+` | Don't announce | All peers |  |
+| `+"`34553:300:1`"+` | Don't announce | AS4200000000 | Don't announce to IX peers |
+| `+"`65535:80`"+` | Set local pref to 80 internally | AS174, AS34553 |  |
+`, ActionCommunityDocs(c))
+}
+
+func TestActionCommunitiesCustomersOnly(t *testing.T) {
+	c, err := Load([]byte(`
+asn: 34553
+router-id: 192.0.2.1
+action-communities-customers-only: true
+action-communities:
+  "34553:200:peer-asn":
+    no-export: true
+peers:
+  Customer:
+    asn: 65510
+    relationship: customer
+    neighbors: [ 192.0.2.13 ]
+  Cogent:
+    asn: 174
+    neighbors: [ 192.0.2.10 ]
+`))
+	assert.Nil(t, err)
+	assert.Equal(t, []config.ExportAction{
+		{Community: "34553,200,174", Large: true, Prepend: util.Ptr(0), NoExport: true, CustomerCommunity: "34553,4,1"},
+	}, *c.Peers["Cogent"].ExportActions)
+
+	// Customer routes can't be identified without customer peers
+	_, err = Load([]byte(`
+asn: 34553
+router-id: 192.0.2.1
+action-communities-customers-only: true
+action-communities:
+  "34553:200:peer-asn":
+    no-export: true
+peers:
+  Cogent:
+    asn: 174
+    neighbors: [ 192.0.2.10 ]
+`))
+	assert.NotNil(t, err)
+}
+
+func TestActionCommunitiesInvalid(t *testing.T) {
+	for community, action := range map[string]string{
+		"34553:100:peer-asn": "{ description: No action }",
+		"34553:101:peer-asn": "{ no-export: true, prepend: 1 }",
+		"34553:103:peer-asn": "{ no-export: true, local-pref: 80 }",
+		"34553:102:peer-asn": "{ prepend: 1, peers: [ Unknown ] }",
+		"34553:peer-asn:1:2": "{ prepend: 1 }",
+	} {
+		_, err := Load([]byte(`
+asn: 34553
+router-id: 192.0.2.1
+action-communities:
+  "` + community + `": ` + action + `
+`))
+		assert.NotNilf(t, err, "community %s", community)
+	}
+}
@@ -0,0 +1,299 @@
+package process
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/natesales/pathvector/pkg/config"
+)
+
+// FlowspecFile is the name of the file in the cache directory storing temporary flowspec rules
+const FlowspecFile = "flowspec.json"
+
+// Flowspec actions
+const (
+	FlowspecDiscard   = "discard"
+	FlowspecRateLimit = "rate-limit"
+	FlowspecRedirect  = "redirect"
+)
+
+// flowspecProtocols maps IP protocol names to protocol numbers
+var flowspecProtocols = map[string]int{
+	"icmp":   1,
+	"tcp":    6,
+	"udp":    17,
+	"gre":    47,
+	"esp":    50,
+	"icmpv6": 58,
+}
+
+// TemporaryFlowspecRule is a flowspec rule added from the command line that is withdrawn after it expires
+type TemporaryFlowspecRule struct {
+	Rule    *config.FlowspecRule `json:"rule"`
+	Expires time.Time            `json:"expires"`
+}
+
+// flowspecPrefix parses a flowspec prefix and returns its canonical form and address family
+func flowspecPrefix(prefix string) (string, string, error) {
+	_, ipNet, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid prefix %s: %s", prefix, err)
+	}
+	if ipNet.IP.To4() != nil {
+		return ipNet.String(), "4", nil
+	}
+	return ipNet.String(), "6", nil
+}
+
+// flowspecNumbers converts a list of numbers and number ranges (low-high) to a BIRD flowspec numeric match
+func flowspecNumbers(values []string, max int) (string, error) {
+	var matches []string
+	for _, value := range values {
+		bounds := strings.SplitN(value, "-", 2)
+		var numbers []int
+		for _, bound := range bounds {
+			n, err := strconv.Atoi(strings.TrimSpace(bound))
+			if err != nil || n < 0 || n > max {
+				return "", fmt.Errorf("invalid value %s (must be a number or range between 0 and %d)", value, max)
+			}
+			numbers = append(numbers, n)
+		}
+		if len(numbers) == 2 {
+			if numbers[0] > numbers[1] {
+				return "", fmt.Errorf("invalid range %s", value)
+			}
+			matches = append(matches, fmt.Sprintf("%d..%d", numbers[0], numbers[1]))
+		} else {
+			matches = append(matches, strconv.Itoa(numbers[0]))
+		}
+	}
+	return strings.Join(matches, ", "), nil
+}
+
+// flowspecCommunity returns the BIRD extended community of a flowspec action
+func flowspecCommunity(rule *config.FlowspecRule) (string, error) {
+	switch rule.Action {
+	case FlowspecDiscard:
+		// Discard is a traffic-rate of 0
+		return "(generic, 0x80060000, 0)", nil
+	case FlowspecRateLimit:
+		if rule.RateLimit <= 0 {
+			return "", fmt.Errorf("rate-limit action requires a rate-limit greater than 0")
+		}
+		return fmt.Sprintf("(generic, 0x80060000, 0x%08x)", math.Float32bits(rule.RateLimit)), nil
+	case FlowspecRedirect:
+		parts := strings.Split(rule.Redirect, ":")
+		if len(parts) != 2 {
+			return "", fmt.Errorf("redirect action requires a redirect route target (ASN:value), got %q", rule.Redirect)
+		}
+		asn, err := strconv.ParseUint(parts[0], 10, 32)
+		if err != nil {
+			return "", fmt.Errorf("invalid redirect ASN %s", parts[0])
+		}
+		if asn <= math.MaxUint16 {
+			value, err := strconv.ParseUint(parts[1], 10, 32)
+			if err != nil {
+				return "", fmt.Errorf("invalid redirect value %s (must be between 0 and %d)", parts[1], uint32(math.MaxUint32))
+			}
+			return fmt.Sprintf("(generic, 0x%08x, %d)", 0x80080000|asn, value), nil
+		}
+		// 4-byte ASNs use the 4-octet AS redirect with a 2 byte value
+		value, err := strconv.ParseUint(parts[1], 10, 16)
+		if err != nil {
+			return "", fmt.Errorf("invalid redirect value %s (must be between 0 and %d with a 4-byte ASN)", parts[1], math.MaxUint16)
+		}
+		return fmt.Sprintf("(generic, 0x%08x, 0x%08x)", 0x82080000|(asn>>16), (asn&0xffff)<<16|value), nil
+	default:
+		return "", fmt.Errorf("invalid action %q (must be one of discard, rate-limit, redirect)", rule.Action)
+	}
+}
+
+// compileFlowspecRule validates a flowspec rule and renders its BIRD flow components and action community
+func compileFlowspecRule(name string, rule *config.FlowspecRule) error {
+	if rule.Destination == "" {
+		return fmt.Errorf("[flowspec %s] destination is required", name)
+	}
+	destination, af, err := flowspecPrefix(rule.Destination)
+	if err != nil {
+		return fmt.Errorf("[flowspec %s] %s", name, err)
+	}
+	components := []string{"dst " + destination}
+
+	if rule.Source != "" {
+		source, sourceAF, err := flowspecPrefix(rule.Source)
+		if err != nil {
+			return fmt.Errorf("[flowspec %s] %s", name, err)
+		}
+		if sourceAF != af {
+			return fmt.Errorf("[flowspec %s] source %s and destination %s must be the same address family", name, rule.Source, rule.Destination)
+		}
+		components = append(components, "src "+source)
+	}
+
+	if rule.Protocol != "" {
+		protocol, found := flowspecProtocols[strings.ToLower(rule.Protocol)]
+		if !found {
+			protocol, err = strconv.Atoi(rule.Protocol)
+			if err != nil || protocol < 0 || protocol > 255 {
+				return fmt.Errorf("[flowspec %s] invalid protocol %s", name, rule.Protocol)
+			}
+		}
+		if af == "4" {
+			components = append(components, fmt.Sprintf("proto %d", protocol))
+		} else {
+			components = append(components, fmt.Sprintf("next header %d", protocol))
+		}
+	}
+
+	for _, numeric := range []struct {
+		component string
+		values    []string
+	}{
+		{"dport", rule.DestinationPorts},
+		{"sport", rule.SourcePorts},
+		{"length", rule.PacketLengths},
+	} {
+		if len(numeric.values) == 0 {
+			continue
+		}
+		match, err := flowspecNumbers(numeric.values, math.MaxUint16)
+		if err != nil {
+			return fmt.Errorf("[flowspec %s] %s %s", name, numeric.component, err)
+		}
+		components = append(components, numeric.component+" "+match)
+	}
+
+	community, err := flowspecCommunity(rule)
+	if err != nil {
+		return fmt.Errorf("[flowspec %s] %s", name, err)
+	}
+
+	rule.AF = af
+	rule.Components = strings.Join(components, "; ") + ";"
+	rule.Community = community
+	return nil
+}
+
+// parseFlowspec compiles all configured flowspec rules
+func parseFlowspec(c *config.Config) error {
+	for name, rule := range c.Flowspec {
+		if err := compileFlowspecRule(name, rule); err != nil {
+			return err
+		}
+	}
+	c.FlowspecEnabled = len(c.Flowspec) > 0
+	for _, peerData := range c.Peers {
+		if *peerData.Flowspec {
+			c.FlowspecEnabled = true
+		}
+	}
+	return nil
+}
+
+// LoadFlowspecRules reads the temporary flowspec rules from the cache directory
+func LoadFlowspecRules(cacheDirectory string) (map[string]*TemporaryFlowspecRule, error) {
+	rules := map[string]*TemporaryFlowspecRule{}
+	contents, err := os.ReadFile(path.Join(cacheDirectory, FlowspecFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return rules, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(contents, &rules); err != nil {
+		return nil, fmt.Errorf("flowspec rules JSON unmarshal: %s", err)
+	}
+	return rules, nil
+}
+
+// saveFlowspecRules writes the temporary flowspec rules to the cache directory
+func saveFlowspecRules(cacheDirectory string, rules map[string]*TemporaryFlowspecRule) error {
+	j, err := json.Marshal(rules)
+	if err != nil {
+		return err
+	}
+	//nolint:golint,gosec
+	return os.WriteFile(path.Join(cacheDirectory, FlowspecFile), j, 0644)
+}
+
+// AddFlowspecRule validates and stores a temporary flowspec rule that expires after a TTL
+func AddFlowspecRule(c *config.Config, name string, rule *config.FlowspecRule, ttl time.Duration) error {
+	if _, found := c.Flowspec[name]; found {
+		return fmt.Errorf("flowspec rule %s is already defined in the config file", name)
+	}
+	if err := compileFlowspecRule(name, rule); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.CacheDirectory, os.FileMode(0755)); err != nil {
+		return err
+	}
+	rules, err := LoadFlowspecRules(c.CacheDirectory)
+	if err != nil {
+		return err
+	}
+	rules[name] = &TemporaryFlowspecRule{Rule: rule, Expires: time.Now().Add(ttl)}
+	return saveFlowspecRules(c.CacheDirectory, rules)
+}
+
+// RemoveFlowspecRule removes a temporary flowspec rule
+func RemoveFlowspecRule(cacheDirectory, name string) error {
+	rules, err := LoadFlowspecRules(cacheDirectory)
+	if err != nil {
+		return err
+	}
+	if _, found := rules[name]; !found {
+		return fmt.Errorf("temporary flowspec rule %s not found", name)
+	}
+	delete(rules, name)
+	return saveFlowspecRules(cacheDirectory, rules)
+}
+
+// mergeFlowspecRules adds unexpired temporary flowspec rules to the config and removes expired rules from the cache directory
+func mergeFlowspecRules(c *config.Config, now time.Time) error {
+	rules, err := LoadFlowspecRules(c.CacheDirectory)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(rules))
+	for name := range rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	expired := false
+	for _, name := range names {
+		rule := rules[name]
+		if !now.Before(rule.Expires) {
+			log.Infof("Withdrawing expired flowspec rule %s", name)
+			delete(rules, name)
+			expired = true
+			continue
+		}
+		if _, found := c.Flowspec[name]; found {
+			log.Warnf("Temporary flowspec rule %s has the same name as a configured rule, ignoring", name)
+			continue
+		}
+		if err := compileFlowspecRule(name, rule.Rule); err != nil {
+			log.Warnf("Ignoring invalid temporary flowspec rule: %s", err)
+			continue
+		}
+		c.Flowspec[name] = rule.Rule
+		c.FlowspecEnabled = true
+	}
+
+	if expired {
+		return saveFlowspecRules(c.CacheDirectory, rules)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package process
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/natesales/pathvector/pkg/config"
+)
+
+func TestCompileFlowspecRule(t *testing.T) {
+	for _, tc := range []struct {
+		rule       config.FlowspecRule
+		components string
+		community  string
+	}{
+		{
+			config.FlowspecRule{Destination: "192.0.2.1/32", Source: "198.51.100.0/24", Protocol: "17", PacketLengths: []string{"0-100", "1500"}, Action: "discard"},
+			"dst 192.0.2.1/32; src 198.51.100.0/24; proto 17; length 0..100, 1500;",
+			"(generic, 0x80060000, 0)",
+		},
+		{
+			config.FlowspecRule{Destination: "2001:db8::/32", Protocol: "icmpv6", Action: "redirect", Redirect: "65510:100"},
+			"dst 2001:db8::/32; next header 58;",
+			"(generic, 0x8008ffe6, 100)",
+		},
+		{
+			config.FlowspecRule{Destination: "192.0.2.0/24", DestinationPorts: []string{"1024-2048"}, Action: "redirect", Redirect: "4200000000:10"},
+			"dst 192.0.2.0/24; dport 1024..2048;",
+			"(generic, 0x8208fa56, 0xea00000a)",
+		},
+	} {
+		t.Run(tc.components, func(t *testing.T) {
+			assert.Nil(t, compileFlowspecRule("test", &tc.rule))
+			assert.Equal(t, tc.components, tc.rule.Components)
+			assert.Equal(t, tc.community, tc.rule.Community)
+		})
+	}
+}
+
+func TestCompileFlowspecRuleInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		rule config.FlowspecRule
+		err  string
+	}{
+		{config.FlowspecRule{Action: "discard"}, "destination is required"},
+		{config.FlowspecRule{Destination: "192.0.2.0/24", Source: "2001:db8::/32", Action: "discard"}, "same address family"},
+		{config.FlowspecRule{Destination: "192.0.2.0/24", Protocol: "sctp", Action: "discard"}, "invalid protocol sctp"},
+		{config.FlowspecRule{Destination: "192.0.2.0/24", DestinationPorts: []string{"100-10"}, Action: "discard"}, "invalid range 100-10"},
+		{config.FlowspecRule{Destination: "192.0.2.0/24", SourcePorts: []string{"70000"}, Action: "discard"}, "invalid value 70000"},
+		{config.FlowspecRule{Destination: "192.0.2.0/24", Action: "rate-limit"}, "rate-limit greater than 0"},
+		{config.FlowspecRule{Destination: "192.0.2.0/24", Action: "redirect"}, "requires a redirect route target"},
+		{config.FlowspecRule{Destination: "192.0.2.0/24", Action: "accept"}, "invalid action"},
+	} {
+		t.Run(tc.err, func(t *testing.T) {
+			assert.ErrorContains(t, compileFlowspecRule("test", &tc.rule), tc.err)
+		})
+	}
+}
+
+func TestTemporaryFlowspecRules(t *testing.T) {
+	c, err := Load([]byte(`
+asn: 34553
+router-id: 192.0.2.1
+flowspec:
+  Configured:
+    destination: 192.0.2.0/24
+    action: discard
+`))
+	assert.Nil(t, err)
+	c.CacheDirectory = t.TempDir()
+
+	assert.ErrorContains(t, AddFlowspecRule(c, "Configured", &config.FlowspecRule{Destination: "192.0.2.0/24", Action: "discard"}, time.Hour), "already defined")
+	assert.ErrorContains(t, AddFlowspecRule(c, "Invalid", &config.FlowspecRule{Destination: "192.0.2.0/24", Action: "accept"}, time.Hour), "invalid action")
+	assert.Nil(t, AddFlowspecRule(c, "Short", &config.FlowspecRule{Destination: "198.51.100.1/32", Action: "discard"}, time.Minute))
+	assert.Nil(t, AddFlowspecRule(c, "Long", &config.FlowspecRule{Destination: "2001:db8::1/128", Action: "discard"}, time.Hour))
+	assert.Nil(t, AddFlowspecRule(c, "Removed", &config.FlowspecRule{Destination: "2001:db8::2/128", Action: "discard"}, time.Hour))
+	assert.Nil(t, RemoveFlowspecRule(c.CacheDirectory, "Removed"))
+	assert.ErrorContains(t, RemoveFlowspecRule(c.CacheDirectory, "Removed"), "not found")
+
+	// The short rule expires and is removed from the cache directory
+	assert.Nil(t, mergeFlowspecRules(c, time.Now().Add(10*time.Minute)))
+	assert.Len(t, c.Flowspec, 2)
+	assert.Equal(t, "dst 2001:db8::1/128;", c.Flowspec["Long"].Components)
+	assert.Equal(t, "6", c.Flowspec["Long"].AF)
+
+	rules, err := LoadFlowspecRules(c.CacheDirectory)
+	assert.Nil(t, err)
+	assert.Len(t, rules, 1)
+	assert.Contains(t, rules, "Long")
+}
@@ -0,0 +1,193 @@
+package process
+
+import (
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/natesales/pathvector/pkg/config"
+	"github.com/natesales/pathvector/pkg/templating"
+	"github.com/natesales/pathvector/pkg/util"
+)
+
+// Impact is the effect that applying a new config will have on a BGP session
+type Impact string
+
+const (
+	ImpactNew          Impact = "new"
+	ImpactRemoved      Impact = "removed"
+	ImpactRestart      Impact = "session restart"
+	ImpactFilterReload Impact = "filter reload only"
+)
+
+// SessionChange is a BGP session that is affected by applying a new config
+type SessionChange struct {
+	Protocol string
+	Peer     string
+	Neighbor string
+	Impact   Impact
+	Fields   []string
+}
+
+// restartFields are the YAML keys of peer fields that change protocol or channel options,
+// causing BIRD to restart the session on reconfigure. Changes to any other peer field only
+// affect filters or limits, which BIRD applies without restarting the session.
+var restartFields = map[string]bool{
+	"disabled":              true,
+	"asn":                   true,
+	"multihop":              true,
+	"listen4":               true,
+	"listen6":               true,
+	"local-asn":             true,
+	"local-port":            true,
+	"neighbor-port":         true,
+	"passive":               true,
+	"direct":                true,
+	"next-hop-self":         true,
+	"next-hop-self-ebgp":    true,
+	"next-hop-self-ibgp":    true,
+	"bfd":                   true,
+	"password":              true,
+	"rs-client":             true,
+	"rr-client":             true,
+	"rr-cluster-id":         true,
+	"mp-unicast-46":         true,
+	"allow-local-as":        true,
+	"add-path-tx":           true,
+	"add-path-rx":           true,
+	"confederation":         true,
+	"confederation-member":  true,
+	"ttl-security":          true,
+	"interpret-communities": true,
+	"default-local-pref":    true,
+	"advertise-hostname":    true,
+	"disable-after-error":   true,
+	"prefer-older-routes":   true,
+	"role":                  true,
+	"require-roles":         true,
+	"session-global":        true,
+	"flowspec":              true,
+}
+
+// ignoredFields are the YAML keys of peer fields that aren't rendered into the BIRD config of a single session
+var ignoredFields = map[string]bool{
+	"template":  true,
+	"tags":      true,
+	"neighbors": true,
+}
+
+// changedFields returns the YAML keys of all peer fields that differ between two peers
+func changedFields(previous, current *config.Peer) []string {
+	var fields []string
+	previousValue := reflect.ValueOf(previous).Elem()
+	currentValue := reflect.ValueOf(current).Elem()
+	peerType := previousValue.Type()
+	for i := 0; i < peerType.NumField(); i++ {
+		key := peerType.Field(i).Tag.Get("yaml")
+		if key == "-" || ignoredFields[key] {
+			continue
+		}
+		if !reflect.DeepEqual(previousValue.Field(i).Interface(), currentValue.Field(i).Interface()) {
+			fields = append(fields, key)
+		}
+	}
+	return fields
+}
+
+// sameSession returns true if a previously deployed protocol is the same BGP session as a current protocol with the
+// same name. Protocols loaded from protocols.json files written before sessions were identified by their neighbor only
+// have a peer name, so their neighbor, ASN and family are unknown and only compared if present.
+func sameSession(previous, current *templating.Protocol) bool {
+	if previous.Neighbor != "" {
+		return previous.Neighbor == current.Neighbor
+	}
+	return previous.Name == current.Name &&
+		(previous.ASN == 0 || previous.ASN == current.ASN) &&
+		(previous.Family == "" || previous.Family == current.Family)
+}
+
+// Impacts compares the previously deployed config and protocol names to the current ones
+// and returns all sessions that are added, removed, restarted, or have their filters reloaded
+func Impacts(previous *config.Config, previousProtocols map[string]*templating.Protocol, current *config.Config, currentProtocols map[string]*templating.Protocol) []SessionChange {
+	var changes []SessionChange
+
+	for protoName, p := range currentProtocols {
+		previousProtocol, found := previousProtocols[protoName]
+		if !found {
+			changes = append(changes, SessionChange{Protocol: protoName, Peer: p.Name, Neighbor: p.Neighbor, Impact: ImpactNew})
+			continue
+		}
+
+		currentPeer := current.Peers[p.Name]
+		previousPeer := previous.Peers[previousProtocol.Name]
+		if !sameSession(previousProtocol, p) {
+			changes = append(changes, SessionChange{Protocol: protoName, Peer: p.Name, Neighbor: p.Neighbor, Impact: ImpactRestart, Fields: []string{"neighbors"}})
+			continue
+		}
+		if previousPeer == nil || currentPeer == nil { // Deployed config doesn't match the deployed protocol names
+			changes = append(changes, SessionChange{Protocol: protoName, Peer: p.Name, Neighbor: p.Neighbor, Impact: ImpactRestart})
+			continue
+		}
+
+		fields := changedFields(previousPeer, currentPeer)
+		if len(fields) == 0 {
+			continue
+		}
+		impact := ImpactFilterReload
+		for _, field := range fields {
+			if restartFields[field] {
+				impact = ImpactRestart
+				break
+			}
+		}
+		changes = append(changes, SessionChange{Protocol: protoName, Peer: p.Name, Neighbor: p.Neighbor, Impact: impact, Fields: fields})
+	}
+
+	for protoName, p := range previousProtocols {
+		if _, found := currentProtocols[protoName]; !found {
+			changes = append(changes, SessionChange{Protocol: protoName, Peer: p.Name, Neighbor: p.Neighbor, Impact: ImpactRemoved})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Protocol < changes[j].Protocol
+	})
+	return changes
+}
+
+// previewImpact prints the impact of applying the current config compared to the config deployed in the BIRD directory
+func previewImpact(c *config.Config, previousProtocols map[string]*templating.Protocol) {
+	deployedFile := path.Join(c.BIRDDirectory, "pathvector.yml")
+	contents, err := os.ReadFile(deployedFile)
+	if err != nil {
+		log.Warnf("Unable to read deployed config, skipping reconfigure impact preview: %v", err)
+		return
+	}
+	previous, err := parse(contents)
+	if err != nil {
+		log.Warnf("Unable to parse deployed config, skipping reconfigure impact preview: %v", err)
+		return
+	}
+
+	changes := Impacts(previous, previousProtocols, c, templating.ProtocolNames())
+	if len(changes) == 0 {
+		log.Info("No sessions are affected by this change")
+		return
+	}
+
+	counts := map[Impact]int{}
+	util.PrintTable([]string{"Protocol", "Peer", "Neighbor", "Impact", "Changed"}, func() [][]string {
+		var table [][]string
+		for _, change := range changes {
+			counts[change.Impact]++
+			table = append(table, []string{change.Protocol, change.Peer, change.Neighbor, string(change.Impact), strings.Join(change.Fields, ", ")})
+		}
+		return table
+	}())
+	log.Infof("Reconfigure impact: %d new, %d removed, %d session restarts, %d filter reloads",
+		counts[ImpactNew], counts[ImpactRemoved], counts[ImpactRestart], counts[ImpactFilterReload])
+}
@@ -0,0 +1,101 @@
+package process
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/natesales/pathvector/pkg/templating"
+)
+
+func TestImpacts(t *testing.T) {
+	previousConfig := `
+asn: 34553
+router-id: 192.0.2.1
+peers:
+  Example:
+    asn: 65510
+    neighbors: [ 203.0.113.1, 2001:db8::1 ]
+  Restarted:
+    asn: 65520
+    neighbors: [ 203.0.113.2 ]
+  Unchanged:
+    asn: 65530
+    tags: [ transit ]
+    neighbors: [ 203.0.113.3 ]
+  Removed:
+    asn: 65540
+    neighbors: [ 203.0.113.4 ]
+  Flowspec:
+    asn: 65560
+    neighbors: [ 203.0.113.6 ]
+`
+	currentConfig := `
+asn: 34553
+router-id: 192.0.2.1
+peers:
+  Renamed Example:
+    asn: 65510
+    local-pref: 200
+    neighbors: [ 203.0.113.1, 2001:db8::1 ]
+  Restarted:
+    asn: 65520
+    local-pref: 200
+    password: secret
+    neighbors: [ 203.0.113.2 ]
+  Unchanged:
+    asn: 65530
+    tags: [ transit, peer ]
+    neighbors: [ 203.0.113.3 ]
+  New:
+    asn: 65550
+    neighbors: [ 203.0.113.5 ]
+  Flowspec:
+    asn: 65560
+    flowspec: true
+    neighbors: [ 203.0.113.6 ]
+`
+
+	previous, err := parse([]byte(previousConfig))
+	assert.Nil(t, err)
+	templating.AllocateProtocolNames(previous.Peers, nil)
+	previousProtocols := templating.ProtocolNames()
+
+	current, err := parse([]byte(currentConfig))
+	assert.Nil(t, err)
+	templating.AllocateProtocolNames(current.Peers, previousProtocols)
+
+	assert.Equal(t, []SessionChange{
+		{Protocol: "EXAMPLE_AS65510_v4", Peer: "Renamed Example", Neighbor: "203.0.113.1", Impact: ImpactFilterReload, Fields: []string{"local-pref"}},
+		{Protocol: "EXAMPLE_AS65510_v6", Peer: "Renamed Example", Neighbor: "2001:db8::1", Impact: ImpactFilterReload, Fields: []string{"local-pref"}},
+		{Protocol: "FLOWSPEC_AS65560_v4", Peer: "Flowspec", Neighbor: "203.0.113.6", Impact: ImpactRestart, Fields: []string{"flowspec"}},
+		{Protocol: "NEW_AS65550_v4", Peer: "New", Neighbor: "203.0.113.5", Impact: ImpactNew},
+		{Protocol: "REMOVED_AS65540_v4", Peer: "Removed", Neighbor: "203.0.113.4", Impact: ImpactRemoved},
+		{Protocol: "RESTARTED_AS65520_v4", Peer: "Restarted", Neighbor: "203.0.113.2", Impact: ImpactRestart, Fields: []string{"local-pref", "password"}},
+	}, Impacts(previous, previousProtocols, current, templating.ProtocolNames()))
+}
+
+func TestImpactsLegacyProtocols(t *testing.T) {
+	c, err := parse([]byte(`
+asn: 34553
+router-id: 192.0.2.1
+peers:
+  Example:
+    asn: 65510
+    neighbors: [ 203.0.113.1, 2001:db8::1 ]
+`))
+	assert.Nil(t, err)
+
+	// protocols.json files written before sessions were identified by neighbor only have the peer name
+	legacyProtocols := map[string]*templating.Protocol{
+		"EXAMPLE_AS65510_v4": {Name: "Example"},
+		"EXAMPLE_AS65510_v6": {Name: "Example"},
+	}
+	templating.AllocateProtocolNames(c.Peers, legacyProtocols)
+	assert.Empty(t, Impacts(c, legacyProtocols, c, templating.ProtocolNames()))
+
+	legacyProtocols["EXAMPLE_AS65510_v4"].Name = "Other"
+	assert.Equal(t, []SessionChange{
+		{Protocol: "EXAMPLE_AS65510_v4", Peer: "Example", Neighbor: "203.0.113.1", Impact: ImpactRestart, Fields: []string{"neighbors"}},
+	}, Impacts(c, legacyProtocols, c, templating.ProtocolNames()))
+}
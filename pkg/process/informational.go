@@ -0,0 +1,84 @@
+package process
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+
+	"github.com/natesales/pathvector/pkg/config"
+)
+
+// defaultPeerTypes maps peer tags to peer type IDs if informational-communities peer-types is empty
+var defaultPeerTypes = map[string]uint32{
+	"transit":  1,
+	"ix":       2,
+	"customer": 3,
+	"private":  4,
+}
+
+// parseInformationalCommunities sets the default peer types and site ID of informational communities
+func parseInformationalCommunities(c *config.Config) error {
+	ic := c.InformationalCommunities
+	if len(ic.PeerTypes) == 0 {
+		ic.PeerTypes = map[string]uint32{}
+		for tag, id := range defaultPeerTypes {
+			ic.PeerTypes[tag] = id
+		}
+	}
+	if ic.Enable && ic.Site == 0 {
+		routerID := net.ParseIP(c.RouterID).To4()
+		if routerID == nil {
+			return fmt.Errorf("informational communities require a site ID or an IPv4 router ID, got %s", c.RouterID)
+		}
+		ic.Site = binary.BigEndian.Uint32(routerID)
+	}
+	return nil
+}
+
+// peerType returns the peer type ID of the first peer tag with a configured peer type
+func peerType(ic *config.InformationalCommunities, peerData *config.Peer) (uint32, bool) {
+	if peerData.Tags == nil {
+		return 0, false
+	}
+	for _, tag := range *peerData.Tags {
+		if id, found := ic.PeerTypes[tag]; found {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+// informationalCommunities returns the informational community patterns to remove from routes imported from a peer,
+// so that peers can't spoof them, and the informational communities to add
+func informationalCommunities(c *config.Config, peerData *config.Peer) (remove []string, add []string) {
+	ic := c.InformationalCommunities
+	for _, function := range []uint32{ic.PeerTypeFunction, ic.SiteFunction, ic.PeerASNFunction} {
+		remove = append(remove, fmt.Sprintf("%d,%d,*", c.ASN, function))
+	}
+
+	if id, found := peerType(ic, peerData); found {
+		add = append(add, fmt.Sprintf("%d,%d,%d", c.ASN, ic.PeerTypeFunction, id))
+	}
+	add = append(add,
+		fmt.Sprintf("%d,%d,%d", c.ASN, ic.SiteFunction, ic.Site),
+		fmt.Sprintf("%d,%d,%d", c.ASN, ic.PeerASNFunction, *peerData.ASN),
+	)
+	return remove, add
+}
+
+// announceClassCommunities returns the peer type communities of routes to announce to a peer with announce-classes
+func announceClassCommunities(c *config.Config, peerName string, classes []string) ([]string, error) {
+	ic := c.InformationalCommunities
+	if !ic.Enable {
+		return nil, fmt.Errorf("[%s] announce-classes requires informational-communities to be enabled", peerName)
+	}
+	var communities []string
+	for _, class := range classes {
+		id, found := ic.PeerTypes[class]
+		if !found {
+			return nil, fmt.Errorf("[%s] unknown announce class %s", peerName, class)
+		}
+		communities = append(communities, fmt.Sprintf("%d,%d,%d", c.ASN, ic.PeerTypeFunction, id))
+	}
+	return communities, nil
+}
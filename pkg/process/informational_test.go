@@ -0,0 +1,72 @@
+package process
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInformationalCommunities(t *testing.T) {
+	configFile := `
+asn: 34553
+router-id: 192.0.2.1
+informational-communities:
+  enable: true
+peers:
+  Upstream:
+    asn: 65510
+    tags: [ transit ]
+    neighbors: [ 203.0.113.1 ]
+  Customer:
+    asn: 65520
+    tags: [ customer ]
+    announce-classes: [ customer ]
+    neighbors: [ 203.0.113.2 ]
+  Internal:
+    asn: 34553
+    neighbors: [ 192.0.2.2 ]
+`
+	c, err := Load([]byte(configFile))
+	assert.Nil(t, err)
+
+	// Site ID defaults to the router ID
+	assert.Equal(t, uint32(3221225985), c.InformationalCommunities.Site)
+
+	upstream := c.Peers["Upstream"]
+	assert.Equal(t, []string{"34553,1,*", "34553,2,*", "34553,3,*"}, *upstream.RemoveLargeCommunities)
+	assert.Equal(t, []string{"34553,1,1", "34553,2,3221225985", "34553,3,65510"}, *upstream.ImportLargeCommunities)
+	assert.Empty(t, *upstream.AnnounceLargeCommunities)
+
+	customer := c.Peers["Customer"]
+	assert.Equal(t, []string{"34553,1,3", "34553,2,3221225985", "34553,3,65520"}, *customer.ImportLargeCommunities)
+	assert.Equal(t, []string{"34553,1,3"}, *customer.AnnounceLargeCommunities)
+
+	internal := c.Peers["Internal"]
+	assert.Empty(t, *internal.ImportLargeCommunities)
+	assert.Empty(t, *internal.RemoveLargeCommunities)
+}
+
+func TestInformationalCommunitiesInvalid(t *testing.T) {
+	testLoadErrors(t, "", []loadErrorTest{
+		{"disabled", `
+asn: 34553
+router-id: 192.0.2.1
+peers:
+  Customer:
+    asn: 65520
+    announce-classes: [ customer ]
+    neighbors: [ 203.0.113.2 ]
+`, "requires informational-communities"},
+		{"unknown class", `
+asn: 34553
+router-id: 192.0.2.1
+informational-communities:
+  enable: true
+peers:
+  Customer:
+    asn: 65520
+    announce-classes: [ backbone ]
+    neighbors: [ 203.0.113.2 ]
+`, "unknown announce class backbone"},
+	})
+}
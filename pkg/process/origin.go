@@ -0,0 +1,96 @@
+package process
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/natesales/pathvector/pkg/config"
+	"github.com/natesales/pathvector/pkg/util"
+)
+
+// parsePrefixOptions validates the announcement options of originated prefixes and categorizes their communities
+func parsePrefixOptions(c *config.Config) error {
+	for prefix, options := range c.PrefixOptions {
+		if options == nil {
+			return fmt.Errorf("prefix options for %s are empty", prefix)
+		}
+		if !util.Contains(c.Prefixes, prefix) && c.Anycast[prefix] == nil {
+			return fmt.Errorf("prefix options for %s, which isn't in prefixes or anycast", prefix)
+		}
+
+		if options.IfRoute != "" {
+			ip := net.ParseIP(options.IfRoute)
+			if ip == nil {
+				return fmt.Errorf("[%s] invalid if-route address %s", prefix, options.IfRoute)
+			}
+			pfx, _, _ := net.ParseCIDR(prefix)
+			if (ip.To4() == nil) != (pfx.To4() == nil) {
+				return fmt.Errorf("[%s] if-route address %s must be the same address family as the prefix", prefix, options.IfRoute)
+			}
+		}
+
+		options.PrependCount = util.Ptr(int(options.Prepends))
+
+		var err error
+		options.StandardCommunities, options.LargeCommunities, err = sortCommunities(options.Communities)
+		if err != nil {
+			return fmt.Errorf("[%s] invalid community: %v", prefix, err)
+		}
+	}
+	return nil
+}
+
+// peerSelectorApplies checks if a peer selector (tag:name, asn:number or a peer name) matches a peer
+func peerSelectorApplies(selector, peerName string, peerData *config.Peer) bool {
+	switch {
+	case strings.HasPrefix(selector, "tag:"):
+		return peerData.Tags != nil && util.Contains(*peerData.Tags, strings.TrimPrefix(selector, "tag:"))
+	case strings.HasPrefix(selector, "asn:"):
+		asn, err := strconv.Atoi(strings.TrimPrefix(selector, "asn:"))
+		return err == nil && asn == *peerData.ASN
+	default:
+		return selector == peerName
+	}
+}
+
+// prefixAnnounced checks if an originated prefix is announced to a peer
+func prefixAnnounced(options *config.PrefixOptions, peerName string, peerData *config.Peer) bool {
+	for _, selector := range options.DontAnnounceTo {
+		if peerSelectorApplies(selector, peerName, peerData) {
+			return false
+		}
+	}
+	if len(options.AnnounceTo) == 0 {
+		return true
+	}
+	for _, selector := range options.AnnounceTo {
+		if peerSelectorApplies(selector, peerName, peerData) {
+			return true
+		}
+	}
+	return false
+}
+
+// noAnnouncePrefixes returns the originated prefixes by address family that aren't announced to a peer
+func noAnnouncePrefixes(c *config.Config, peerName string, peerData *config.Peer) (prefixes4 []string, prefixes6 []string) {
+	prefixes := make([]string, 0, len(c.PrefixOptions))
+	for prefix := range c.PrefixOptions {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+
+	for _, prefix := range prefixes {
+		if prefixAnnounced(c.PrefixOptions[prefix], peerName, peerData) {
+			continue
+		}
+		if util.Contains(c.Prefixes6, prefix) {
+			prefixes6 = append(prefixes6, prefix)
+		} else {
+			prefixes4 = append(prefixes4, prefix)
+		}
+	}
+	return prefixes4, prefixes6
+}
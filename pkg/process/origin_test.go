@@ -0,0 +1,76 @@
+package process
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrefixOptions(t *testing.T) {
+	c, err := Load([]byte(`
+asn: 34553
+router-id: 192.0.2.1
+prefixes:
+  - 192.0.2.0/24
+  - 198.51.100.0/24
+  - 2001:db8::/48
+prefix-options:
+  192.0.2.0/24:
+    communities: [ "34553:100", "34553:1:100" ]
+    prepends: 2
+    announce-to: [ tag:transit ]
+  198.51.100.0/24:
+    if-route: 203.0.113.10
+  2001:db8::/48:
+    dont-announce-to: [ asn:65520, Upstream ]
+peers:
+  Upstream:
+    asn: 65510
+    tags: [ transit ]
+    neighbors: [ 203.0.113.1, 2001:db8::1 ]
+  Peer:
+    asn: 65520
+    neighbors: [ 203.0.113.2, 2001:db8::2 ]
+`))
+	assert.Nil(t, err)
+
+	options := c.PrefixOptions["192.0.2.0/24"]
+	assert.Equal(t, []string{"34553,100"}, options.StandardCommunities)
+	assert.Equal(t, []string{"34553,1,100"}, options.LargeCommunities)
+	assert.Equal(t, 2, *options.PrependCount)
+
+	assert.Empty(t, *c.Peers["Upstream"].NoAnnouncePrefixes4)
+	assert.Equal(t, []string{"2001:db8::/48"}, *c.Peers["Upstream"].NoAnnouncePrefixes6)
+	assert.Equal(t, []string{"192.0.2.0/24"}, *c.Peers["Peer"].NoAnnouncePrefixes4)
+	assert.Equal(t, []string{"2001:db8::/48"}, *c.Peers["Peer"].NoAnnouncePrefixes6)
+
+	output := renderTest(t, c)
+	global := output["bird.conf"]
+	assert.Contains(t, global, "route 192.0.2.0/24 reject;")
+	assert.Contains(t, global, "route 198.51.100.0/24 recursive 203.0.113.10;")
+	assert.Contains(t, global, "if (dest != RTD_UNICAST) then _reject(\"conditional route to 203.0.113.10 is down\");")
+	assert.Contains(t, global, "if (net = 192.0.2.0/24 && proto = \"static4\") then {")
+	assert.Contains(t, global, "if (net = 2001:db8::/48 && proto = \"static6\") then {")
+
+	// Recursive routes aren't exported to the kernel
+	assert.Contains(t, global, "if (proto = \"static4\" && net = 198.51.100.0/24) then reject;")
+	assert.NotContains(t, global, "if (proto = \"static4\" && net = 192.0.2.0/24) then reject;")
+	assert.Contains(t, global, "bgp_community.add((34553,100));")
+	assert.Contains(t, global, "bgp_large_community.add((34553,1,100));")
+
+	assert.Contains(t, output["AS65520_PEER.conf"], "if (source = RTS_STATIC && net ~ [\n              192.0.2.0/24\n            ]) then _reject(\"originated prefix not announced to this peer\");")
+}
+
+func TestPrefixOptionsInvalid(t *testing.T) {
+	testLoadErrors(t, `
+asn: 34553
+router-id: 192.0.2.1
+prefixes: [ 192.0.2.0/24 ]
+prefix-options:
+  `, []loadErrorTest{
+		{"unknown prefix", "203.0.113.0/24: { prepends: 1 }", "isn't in prefixes"},
+		{"invalid if-route", "192.0.2.0/24: { if-route: example }", "invalid if-route address example"},
+		{"if-route family", "192.0.2.0/24: { if-route: \"2001:db8::1\" }", "same address family"},
+		{"invalid community", "192.0.2.0/24: { communities: [ \"34553\" ] }", "invalid community"},
+	})
+}
@@ -9,6 +9,7 @@ import (
 	"os"
 	"path"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -22,7 +23,9 @@ import (
 	"github.com/natesales/pathvector/pkg/block"
 	"github.com/natesales/pathvector/pkg/config"
 	"github.com/natesales/pathvector/pkg/embed"
+	"github.com/natesales/pathvector/pkg/healthcheck"
 	"github.com/natesales/pathvector/pkg/irr"
+	"github.com/natesales/pathvector/pkg/optimizer"
 	"github.com/natesales/pathvector/pkg/peeringdb"
 	"github.com/natesales/pathvector/pkg/plugin"
 	"github.com/natesales/pathvector/pkg/templating"
@@ -136,6 +139,32 @@ func templateReplacements(in string, peer *config.Peer) string {
 
 // Load loads a configuration file from a YAML file
 func Load(configBlob []byte) (*config.Config, error) {
+	c, err := parse(configBlob)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set PeeringDB URL
+	peeringdb.Endpoint = c.PeeringDBURL
+	log.Debugf("Setting PeeringDB endpoint to %s", peeringdb.Endpoint)
+
+	// Set external query limits
+	peeringdb.SetWorkers(c.PeeringDBQueryWorkers)
+	peeringdb.MaxRetries = c.PeeringDBQueryRetries
+	irr.SetWorkers(c.IRRQueryWorkers)
+
+	// Load PeeringDB snapshot
+	if c.PeeringDBSnapshot != "" {
+		if err := peeringdb.LoadSnapshot(c.PeeringDBSnapshot, c.PeeringDBSnapshotMaxAge); err != nil {
+			log.Warnf("%s, falling back to live PeeringDB queries", err)
+		}
+	}
+
+	return c, nil // nil error
+}
+
+// parse parses and validates a configuration file without modifying any package state
+func parse(configBlob []byte) (*config.Config, error) {
 	var c config.Config
 	c.Init()
 	defaults.MustSet(&c)
@@ -156,10 +185,6 @@ func Load(configBlob []byte) (*config.Config, error) {
 		}
 	}
 
-	// Set PeeringDB URL
-	peeringdb.Endpoint = c.PeeringDBURL
-	log.Debugf("Setting PeeringDB endpoint to %s", peeringdb.Endpoint)
-
 	// Set hostname if empty
 	if c.Hostname == "" {
 		hostname, err := os.Hostname()
@@ -169,6 +194,11 @@ func Load(configBlob []byte) (*config.Config, error) {
 		c.Hostname = hostname
 	}
 
+	// Add iBGP sessions from the router inventory
+	if err := parseRouters(&c); err != nil {
+		return nil, err
+	}
+
 	if c.Stun {
 		c.NoAnnounce = true
 		c.NoAccept = true
@@ -224,6 +254,12 @@ func Load(configBlob []byte) (*config.Config, error) {
 			}
 		} // end peer template processor
 
+		if err := applyRelationship(peerName, peerData); err != nil {
+			return nil, err
+		}
+		applyRouteServer(&c, peerData)
+		applyIBGP(&c, peerName, peerData)
+
 		// Set default values
 		peerValue := reflect.ValueOf(c.Peers[peerName]).Elem()
 		templateValueType := peerValue.Type()
@@ -291,6 +327,9 @@ func Load(configBlob []byte) (*config.Config, error) {
 		if peerData.DefaultLocalPref != nil && util.Deref(peerData.OptimizeInbound) {
 			log.Fatalf("Both DefaultLocalPref and OptimizeInbound set, Pathvector cannot optimize this peer.")
 		}
+		if util.Deref(peerData.OptimizeInbound) || util.Deref(peerData.SteerOutbound) {
+			c.OptimizerEnabled = true
+		}
 
 		if peerData.OnlyAnnounce != nil && util.Deref(peerData.AnnounceAll) {
 			log.Fatalf("[%s] only-announce and announce-all cannot both be true", peerName)
@@ -364,6 +403,40 @@ func Load(configBlob []byte) (*config.Config, error) {
 
 	} // end peer list
 
+	// Check for peers that would be rendered to the same protocol names and config file
+	peerNames := make([]string, 0, len(c.Peers))
+	for peerName := range c.Peers {
+		peerNames = append(peerNames, peerName)
+	}
+	sort.Strings(peerNames)
+	peerFiles := map[string]string{}
+	for _, peerName := range peerNames {
+		peerData := c.Peers[peerName]
+		peerFile := fmt.Sprintf("AS%d_%s", *peerData.ASN, *peerData.ProtocolName)
+		if other, found := peerFiles[peerFile]; found {
+			return nil, fmt.Errorf("peers %s and %s have the same ASN and sanitized name %s", other, peerName, *peerData.ProtocolName)
+		}
+		peerFiles[peerFile] = peerName
+	}
+
+	// Resolve action communities that apply to each peer
+	if err := validateActionCommunities(&c); err != nil {
+		return nil, err
+	}
+	for peerName, peerData := range c.Peers {
+		peerData.ExportActions = util.Ptr(exportActions(&c, peerName, peerData))
+
+		// Interpret route server action communities
+		if c.RouteServer.Enable && *peerData.RSClient && c.RouteServer.ActionCommunities {
+			actions, policy := routeServerActions(&c, peerData)
+			peerData.ExportActions = util.Ptr(append(*peerData.ExportActions, actions...))
+			peerData.RouteServerPolicy = policy
+		}
+		if c.RouteServer.Enable && *peerData.RSClient && c.RouteServer.Descriptions {
+			peerData.Description = util.Ptr(routeServerDescription(peerName, peerData))
+		}
+	}
+
 	// Parse origin routes by assembling OriginIPv{4,6} lists by address family
 	for _, prefix := range c.Prefixes {
 		pfx, _, err := net.ParseCIDR(prefix)
@@ -377,6 +450,17 @@ func Load(configBlob []byte) (*config.Config, error) {
 			c.Prefixes4 = append(c.Prefixes4, prefix)
 		}
 	}
+	if err := parseAnycast(&c); err != nil {
+		return nil, err
+	}
+	if err := parsePrefixOptions(&c); err != nil {
+		return nil, err
+	}
+	for peerName, peerData := range c.Peers {
+		prefixes4, prefixes6 := noAnnouncePrefixes(&c, peerName, peerData)
+		peerData.NoAnnouncePrefixes4 = &prefixes4
+		peerData.NoAnnouncePrefixes6 = &prefixes6
+	}
 
 	// Initialize static maps
 	c.Kernel.Statics4 = map[string]string{}
@@ -430,6 +514,18 @@ func Load(configBlob []byte) (*config.Config, error) {
 		}
 	}
 
+	// Validate BMP station
+	if c.BMP.Station != "" && net.ParseIP(c.BMP.Station) == nil {
+		return nil, fmt.Errorf("invalid BMP station %s", c.BMP.Station)
+	}
+
+	if err := parseInformationalCommunities(&c); err != nil {
+		return nil, err
+	}
+	if err := parseFlowspec(&c); err != nil {
+		return nil, err
+	}
+
 	// Parse BFD configs
 	for instanceName, bfdInstance := range c.BFDInstances {
 		if net.ParseIP(*bfdInstance.Neighbor) == nil {
@@ -478,7 +574,8 @@ func Load(configBlob []byte) (*config.Config, error) {
 		c.RTRServerPort = rtrServerPort
 	}
 
-	for _, peerData := range c.Peers {
+	relationships := hasRelationships(&c)
+	for peerName, peerData := range c.Peers {
 		// Build static prefix filters
 		if peerData.Prefixes != nil {
 			for _, prefix := range *peerData.Prefixes {
@@ -521,6 +618,28 @@ func Load(configBlob []byte) (*config.Config, error) {
 			return nil, fmt.Errorf("invalid remove community: %v", err)
 		}
 
+		// Tag routes imported from peers with their relationship
+		if relationships {
+			remove, add, announce := relationshipCommunities(&c, peerData)
+			peerData.RemoveLargeCommunities = util.Ptr(append(*peerData.RemoveLargeCommunities, remove...))
+			peerData.ImportLargeCommunities = util.Ptr(append(*peerData.ImportLargeCommunities, add...))
+			peerData.AnnounceLargeCommunities = util.Ptr(append(*peerData.AnnounceLargeCommunities, announce...))
+		}
+
+		// Tag routes imported from external peers with informational communities
+		if c.InformationalCommunities.Enable && *peerData.ASN != c.ASN {
+			remove, add := informationalCommunities(&c, peerData)
+			peerData.RemoveLargeCommunities = util.Ptr(append(*peerData.RemoveLargeCommunities, remove...))
+			peerData.ImportLargeCommunities = util.Ptr(append(*peerData.ImportLargeCommunities, add...))
+		}
+		if peerData.AnnounceClasses != nil {
+			communities, err := announceClassCommunities(&c, peerName, *peerData.AnnounceClasses)
+			if err != nil {
+				return nil, err
+			}
+			peerData.AnnounceLargeCommunities = util.Ptr(append(*peerData.AnnounceLargeCommunities, communities...))
+		}
+
 		// Check for no originated prefixes but announce-originated enabled
 		if len(c.Prefixes) < 1 && *peerData.AnnounceOriginated {
 			// No locally originated prefixes are defined, so there's nothing to originate
@@ -590,6 +709,7 @@ func peer(peerName string, peerData *config.Peer, c *config.Config, wg *sync.Wai
 	if err != nil {
 		log.Fatalf("Create peer specific output file: %v", err)
 	}
+	defer peerSpecificFile.Close()
 
 	// Render the template and write to buffer
 	var b bytes.Buffer
@@ -610,6 +730,65 @@ func peer(peerName string, peerData *config.Peer, c *config.Config, wg *sync.Wai
 	log.Debugf("[%s] Wrote config", peerName)
 }
 
+// render writes the global and peer-specific configs to the cache directory
+func render(c *config.Config) {
+	// Create the global output file
+	log.Debug("Creating global config")
+	globalFile, err := os.Create(path.Join(c.CacheDirectory, "bird.conf"))
+	if err != nil {
+		log.Fatalf("Create global BIRD output file: %v", err)
+	}
+	defer globalFile.Close()
+	log.Debug("Finished creating global config file")
+
+	// Render the global template and write to buffer
+	log.Debug("Writing global config file")
+	if err := templating.Template.ExecuteTemplate(globalFile, "global.tmpl", c); err != nil {
+		log.Fatalf("Execute global template: %v", err)
+	}
+	log.Debug("Finished writing global config file")
+
+	// Write optimizer include file, keeping the local pref of peers depreferred and prefixes steered by the optimizer
+	if c.OptimizerEnabled {
+		state, err := optimizer.LoadState(c.CacheDirectory)
+		if err != nil {
+			log.Warnf("Reading optimizer state: %v", err)
+		}
+		steering, err := optimizer.LoadSteering(c.CacheDirectory)
+		if err != nil {
+			log.Warnf("Reading optimizer steering: %v", err)
+		}
+		if err := optimizer.WriteOverrides(c, state, steering, c.CacheDirectory); err != nil {
+			log.Fatalf("Writing optimizer include file: %v", err)
+		}
+	}
+
+	// Iterate over peers
+	log.Debug("Processing peers")
+	wg := new(sync.WaitGroup)
+	for peerName, peerData := range c.Peers {
+		wg.Add(1)
+		go peer(peerName, peerData, c, wg)
+	} // end peer loop
+	wg.Wait()
+}
+
+// enableBMP enables the BMP station if one is configured and BIRD supports it
+func enableBMP(c *config.Config) {
+	if c.BMP.Station == "" {
+		return
+	}
+	birdVersion, err := bird.BinaryVersion(c.BIRDBinary)
+	if err != nil {
+		log.Warnf("Unable to determine BIRD version, assuming BMP is supported: %v", err)
+		c.BMP.Enabled = true
+	} else if bird.SupportsBMP(birdVersion) {
+		c.BMP.Enabled = true
+	} else {
+		log.Warnf("BIRD %s doesn't support BMP (requires %s or newer), not configuring BMP station %s", birdVersion, bird.BMPMin, c.BMP.Station)
+	}
+}
+
 // Run runs the full data generation procedure
 func Run(configFilename, lockFile, version string, noConfigure, dryRun, withdraw bool) {
 	// Check lockfile
@@ -666,20 +845,20 @@ func Run(configFilename, lockFile, version string, noConfigure, dryRun, withdraw
 		log.Fatal(err)
 	}
 
-	// Create the global output file
-	log.Debug("Creating global config")
-	globalFile, err := os.Create(path.Join(c.CacheDirectory, "bird.conf"))
-	if err != nil {
-		log.Fatalf("Create global BIRD output file: %v", err)
+	// Add temporary flowspec rules
+	if err := mergeFlowspecRules(c, time.Now()); err != nil {
+		log.Fatalf("Loading temporary flowspec rules: %v", err)
 	}
-	log.Debug("Finished creating global config file")
 
-	// Render the global template and write to buffer
-	log.Debug("Writing global config file")
-	if err := templating.Template.ExecuteTemplate(globalFile, "global.tmpl", c); err != nil {
-		log.Fatalf("Execute global template: %v", err)
+	// Add blackhole requests
+	if err := mergeBlackholes(c, time.Now()); err != nil {
+		log.Fatalf("Loading blackhole requests: %v", err)
+	}
+
+	// Set anycast prefix state from health checks
+	if err := loadAnycastState(c); err != nil {
+		log.Fatalf("Loading anycast state: %v", err)
 	}
-	log.Debug("Finished writing global config file")
 
 	// Remove old manual configs
 	if err := util.RemoveFileGlob(path.Join(c.CacheDirectory, "manual*.conf")); err != nil {
@@ -704,14 +883,19 @@ func Run(configFilename, lockFile, version string, noConfigure, dryRun, withdraw
 		c.NoAnnounce = true
 	}
 
-	// Iterate over peers
-	log.Debug("Processing peers")
-	wg := new(sync.WaitGroup)
-	for peerName, peerData := range c.Peers {
-		wg.Add(1)
-		go peer(peerName, peerData, c, wg)
-	} // end peer loop
-	wg.Wait()
+	// Allocate protocol names, reusing names from the previous run
+	previousNames, err := templating.LoadProtocolNames(path.Join(c.BIRDDirectory, "protocols.json"))
+	if err != nil {
+		log.Debugf("Unable to read previous protocol names, allocating new names: %v", err)
+	}
+	templating.AllocateProtocolNames(c.Peers, previousNames)
+
+	if dryRun {
+		previewImpact(c, previousNames)
+	}
+
+	enableBMP(c)
+	render(c)
 
 	// Run BIRD config validation
 	bird.Validate(c.BIRDBinary, c.CacheDirectory)
@@ -757,6 +941,131 @@ func Run(configFilename, lockFile, version string, noConfigure, dryRun, withdraw
 	log.Infof("Processed %d sessions over %d peers in %s", countSessions(c.Peers), len(c.Peers), time.Since(startTime).Round(time.Second))
 }
 
+// loadRouterState loads a router's runtime state from its directory in the state directory, which holds copies of the
+// router's cache directory state files, protocols.json and manual configs, and returns its previous protocol names
+func loadRouterState(c *config.Config, routerStateDirectory string) (map[string]*templating.Protocol, error) {
+	// Copy state files to the output directory, so expired entries are removed from the copies only
+	for _, file := range []string{FlowspecFile, BlackholeFile, healthcheck.StateFile} {
+		if _, err := os.Stat(path.Join(routerStateDirectory, file)); err != nil {
+			continue
+		}
+		if err := util.CopyFile(path.Join(routerStateDirectory, file), path.Join(c.CacheDirectory, file)); err != nil {
+			return nil, fmt.Errorf("copying %s: %v", file, err)
+		}
+	}
+
+	if err := mergeFlowspecRules(c, time.Now()); err != nil {
+		return nil, fmt.Errorf("loading temporary flowspec rules: %v", err)
+	}
+	if err := mergeBlackholes(c, time.Now()); err != nil {
+		return nil, fmt.Errorf("loading blackhole requests: %v", err)
+	}
+	if err := loadAnycastState(c); err != nil {
+		return nil, fmt.Errorf("loading anycast state: %v", err)
+	}
+	if err := util.CopyFileToGlob(path.Join(routerStateDirectory, "manual*.conf"), c.CacheDirectory); err != nil {
+		return nil, fmt.Errorf("copying manual config files: %v", err)
+	}
+
+	previousNames, err := templating.LoadProtocolNames(path.Join(routerStateDirectory, "protocols.json"))
+	if err != nil {
+		log.Debugf("[%s] Unable to read previous protocol names, allocating new names: %v", c.Hostname, err)
+	}
+	return previousNames, nil
+}
+
+// RunAll renders the config of every router in the inventory into a directory named after its hostname in the output
+// directory, without configuring BIRD. Runtime state is loaded from a directory named after each router's hostname in
+// the state directory. Without a state directory, the rendered configs are only suitable for validation.
+func RunAll(configFilename, outputDirectory, stateDirectory, version string, validate bool) {
+	log.Infof("Starting Pathvector %s", version)
+	startTime := time.Now()
+
+	if stateDirectory == "" {
+		log.Warn("No state directory set, rendering for validation only: anycast prefixes are withdrawn, blackhole " +
+			"requests, temporary flowspec rules and manual configs aren't included, and protocol names are newly allocated")
+	}
+
+	log.Debugf("Loading config from %s", configFilename)
+	configFile, err := os.ReadFile(configFilename)
+	if err != nil {
+		log.Fatalf("Reading config file: %s", err)
+	}
+	configs, err := RouterConfigs(configFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	hostnames := make([]string, 0, len(configs))
+	for hostname := range configs {
+		hostnames = append(hostnames, hostname)
+	}
+	sort.Strings(hostnames)
+
+	log.Debug("Loading templates from embedded filesystem")
+	if err := templating.Load(embed.FS); err != nil {
+		log.Fatal(err)
+	}
+
+	var nvrsASNs []uint32
+	for _, hostname := range hostnames {
+		c, err := Load(configs[hostname])
+		if err != nil {
+			log.Fatalf("[%s] %s", hostname, err)
+		}
+
+		// Query NVRS once for all routers
+		if c.QueryNVRS {
+			if nvrsASNs == nil {
+				nvrsASNs, err = peeringdb.NeverViaRouteServers(c.PeeringDBQueryTimeout, c.PeeringDBAPIKey)
+				if err != nil {
+					log.Fatalf("PeeringDB NVRS query: %s", err)
+				}
+			}
+			c.NVRSASNs = nvrsASNs
+		}
+
+		c.CacheDirectory = path.Join(outputDirectory, hostname)
+		log.Debugf("[%s] Making output directory %s", hostname, c.CacheDirectory)
+		if err := os.MkdirAll(c.CacheDirectory, os.FileMode(0755)); err != nil {
+			log.Fatal(err)
+		}
+		if err := util.RemoveFileGlob(path.Join(c.CacheDirectory, "AS*.conf")); err != nil {
+			log.Fatalf("[%s] Removing old peer config files: %v", hostname, err)
+		}
+		if err := util.RemoveFileGlob(path.Join(c.CacheDirectory, "manual*.conf")); err != nil {
+			log.Fatalf("[%s] Removing old manual config files: %v", hostname, err)
+		}
+
+		var previousNames map[string]*templating.Protocol
+		if stateDirectory != "" {
+			previousNames, err = loadRouterState(c, path.Join(stateDirectory, hostname))
+			if err != nil {
+				log.Fatalf("[%s] %v", hostname, err)
+			}
+		} else if len(c.Anycast) > 0 {
+			log.Warnf("[%s] Rendering %d anycast prefixes as withdrawn without health check state", hostname, len(c.Anycast))
+		}
+		templating.AllocateProtocolNames(c.Peers, previousNames)
+		enableBMP(c)
+		render(c)
+
+		// Write the router's config file with its overrides applied
+		//nolint:golint,gosec
+		if err := os.WriteFile(path.Join(c.CacheDirectory, "pathvector.yml"), configs[hostname], 0644); err != nil {
+			log.Fatalf("[%s] Writing config file: %v", hostname, err)
+		}
+
+		if validate {
+			log.Infof("[%s] Validating BIRD config", hostname)
+			bird.Validate(c.BIRDBinary, c.CacheDirectory)
+		}
+		log.Infof("[%s] Rendered %d sessions over %d peers to %s", hostname, countSessions(c.Peers), len(c.Peers), c.CacheDirectory)
+	}
+
+	log.Infof("Processed %d routers in %s", len(hostnames), time.Since(startTime).Round(time.Second))
+}
+
 func countSessions(peers map[string]*config.Peer) int {
 	var count int
 	for _, p := range peers {
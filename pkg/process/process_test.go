@@ -1,11 +1,18 @@
 package process
 
 import (
+	"encoding/json"
+	"os"
+	"path"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/natesales/pathvector/pkg/config"
+	"github.com/natesales/pathvector/pkg/embed"
+	"github.com/natesales/pathvector/pkg/templating"
 	"github.com/natesales/pathvector/pkg/util"
 )
 
@@ -290,3 +297,215 @@ peers:
 		}
 	}
 }
+
+func TestRenderDeterministic(t *testing.T) {
+	configFile := `
+asn: 34553
+router-id: 192.0.2.1
+source4: 192.0.2.1
+source6: 2001:db8::1
+prefixes:
+  - 192.0.2.0/24
+  - 198.51.100.0/24
+  - 2001:db8::/48
+rpki-enable: false
+origin-communities: [ "34553:10", "34553:10:1" ]
+add-on-import: [ "34553:1", "34553:34553:1" ]
+kernel:
+  statics:
+    "203.0.113.0/24": "192.0.2.10"
+    "203.0.113.128/25": "192.0.2.11"
+    "2001:db8:2::/64": "2001:db8::10"
+    "2001:db8:3::/64": "2001:db8::11"
+bmp:
+  station: 192.0.2.30
+  monitor-post-policy: true
+bfd:
+  BFD 1:
+    neighbor: 192.0.2.20
+    interface: eth0
+  BFD 2:
+    neighbor: 192.0.2.21
+    interface: eth1
+action-communities:
+  "34553:102:peer-asn":
+    prepend: 2
+  "34553:200:peer-asn":
+    no-export: true
+flowspec:
+  DNS amplification:
+    destination: 192.0.2.0/24
+    protocol: udp
+    source-ports: [ 53 ]
+    action: rate-limit
+    rate-limit: 1250000
+  Web attack:
+    destination: 2001:db8::/48
+    protocol: tcp
+    destination-ports: [ 80, 443 ]
+    action: discard
+authorized-providers:
+  65510: [ 65520, 65530 ]
+  65520: [ 65530 ]
+templates:
+  upstream:
+    local-pref: 80
+    filter-transit-asns: true
+    tags: [ transit ]
+peers:
+  Example:
+    asn: 65510
+    template: upstream
+    neighbors: [ 203.0.113.1, 203.0.113.2, 2001:db8::1, 2001:db8::2 ]
+    as-prefs:
+      65510: 10
+      65520: 20
+      65530: 30
+    community-prefs:
+      65510,30: 100
+      65510,20: 200
+      65510,20,30: 300
+    prefix-communities:
+      "192.0.2.0/24": [ "123,456", "1:2:3" ]
+      "198.51.100.0/24": [ "123,789" ]
+  Example 2:
+    asn: 65510
+    neighbors: [ 203.0.113.3, 2001:db8::3 ]
+  Other Peer:
+    asn: 65520
+    filter-aspa: true
+    optimize-inbound: true
+    steer-outbound: true
+    prefixes: [ 198.51.100.0/24, 2001:db8:1::/48 ]
+    neighbors: [ 203.0.113.4 ]
+  Internal:
+    asn: 34553
+    announce-all: true
+    mp-unicast-46: true
+    flowspec: true
+    neighbors: [ 192.0.2.3, 2001:db8::3 ]
+`
+
+	var first map[string]string
+	for i := 0; i < 5; i++ {
+		c, err := Load([]byte(configFile))
+		assert.Nil(t, err)
+		c.BMP.Enabled = true
+		output := renderTest(t, c)
+
+		protocols, err := json.Marshal(templating.ProtocolNames())
+		assert.Nil(t, err)
+		output["protocols.json"] = string(protocols)
+
+		if first == nil {
+			first = output
+			assert.Len(t, first, 7)
+			assert.Contains(t, first["bird.conf"], "include \"optimizer.conf\";")
+			assert.Contains(t, first["optimizer.conf"], "define AS65520_OTHER_PEER_OPTIMIZER_LOCAL_PREF = 100;")
+			assert.Contains(t, first["AS65520_OTHER_PEER.conf"], "bgp_local_pref = AS65520_OTHER_PEER_OPTIMIZER_LOCAL_PREF;")
+			assert.Contains(t, first["AS65520_OTHER_PEER.conf"], "if ((34553,200,65520) ~ bgp_large_community) then _reject(\"action community 34553,200,65520\");")
+			assert.Contains(t, first["AS65520_OTHER_PEER.conf"], "if ((34553,102,65520) ~ bgp_large_community) then {\n")
+			assert.Contains(t, first["bird.conf"], "station address ip 192.0.2.30 port 1790;")
+			assert.Contains(t, first["bird.conf"], "monitoring rib in pre_policy;")
+			assert.Contains(t, first["bird.conf"], "monitoring rib in post_policy;")
+			assert.Contains(t, first["optimizer.conf"], "function AS65520_OTHER_PEER_OPTIMIZER_STEER() {")
+			assert.Contains(t, first["AS65520_OTHER_PEER.conf"], "AS65520_OTHER_PEER_OPTIMIZER_STEER();")
+			assert.Contains(t, first["AS65510_EXAMPLE.conf"], "protocol bgp EXAMPLE_AS65510_v4 {")
+			assert.Contains(t, first["AS65510_EXAMPLE.conf"], "protocol bgp EXAMPLE_AS65510_v4_1 {")
+			assert.Contains(t, first["AS65510_EXAMPLE.conf"], "protocol bgp EXAMPLE_AS65510_v6_1 {")
+			assert.Contains(t, first["bird.conf"], "route flow4 { dst 192.0.2.0/24; proto 17; sport 53; } { bgp_ext_community.add((generic, 0x80060000, 0x49989680)); };")
+			assert.Contains(t, first["bird.conf"], "route flow6 { dst 2001:db8::/48; next header 6; dport 80, 443; } { bgp_ext_community.add((generic, 0x80060000, 0)); };")
+			assert.Contains(t, first["AS34553_INTERNAL.conf"], "table flowtab4;")
+			assert.Contains(t, first["AS34553_INTERNAL.conf"], "table flowtab6;")
+			assert.NotContains(t, first["AS65510_EXAMPLE.conf"], "flowtab")
+			continue
+		}
+		for file, contents := range first {
+			assert.Equalf(t, contents, output[file], "%s differs between runs", file)
+		}
+	}
+}
+
+func TestRenderWithoutOptimizer(t *testing.T) {
+	c, err := Load([]byte(`
+asn: 34553
+router-id: 192.0.2.1
+peers:
+  Example:
+    asn: 65510
+    neighbors: [ 192.0.2.2 ]
+`))
+	assert.Nil(t, err)
+	output := renderTest(t, c)
+	assert.NotContains(t, output, "optimizer.conf")
+	assert.NotContains(t, output["bird.conf"], "optimizer.conf")
+}
+
+func TestLoadDuplicateSanitizedName(t *testing.T) {
+	configFile := `
+asn: 34553
+router-id: 192.0.2.1
+peers:
+  Example:
+    asn: 65510
+    neighbors: [ 203.0.113.1 ]
+  EXAMPLE:
+    asn: 65510
+    neighbors: [ 203.0.113.2 ]
+`
+	_, err := Load([]byte(configFile))
+	assert.ErrorContains(t, err, "same ASN and sanitized name EXAMPLE")
+}
+
+func TestLoadConfigInvalidBMPStation(t *testing.T) {
+	configFile := `
+asn: 34553
+router-id: 192.0.2.1
+bmp:
+  station: bmp.example.com
+`
+	_, err := Load([]byte(configFile))
+	assert.ErrorContains(t, err, "invalid BMP station")
+}
+
+// renderTest renders a config into a temporary directory and returns the contents of the rendered files by name
+func renderTest(t *testing.T, c *config.Config) map[string]string {
+	t.Helper()
+	assert.Nil(t, templating.Load(embed.FS))
+
+	cacheDirectory := c.CacheDirectory
+	c.CacheDirectory = t.TempDir()
+	defer func() {
+		c.CacheDirectory = cacheDirectory
+	}()
+	templating.AllocateProtocolNames(c.Peers, nil)
+	render(c)
+
+	files, err := filepath.Glob(path.Join(c.CacheDirectory, "*.conf"))
+	assert.Nil(t, err)
+	output := map[string]string{}
+	for _, file := range files {
+		contents, err := os.ReadFile(file)
+		assert.Nil(t, err)
+		output[path.Base(file)] = string(contents)
+	}
+	return output
+}
+
+// loadErrorTest is a config snippet that Load must reject with an error containing err
+type loadErrorTest struct {
+	name   string
+	config string
+	err    string
+}
+
+// testLoadErrors checks that Load rejects each config snippet appended to a base config
+func testLoadErrors(t *testing.T, base string, tests []loadErrorTest) {
+	t.Helper()
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Load([]byte(base + tc.config + "\n"))
+			assert.ErrorContains(t, err, tc.err)
+		})
+	}
+}
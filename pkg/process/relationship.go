@@ -0,0 +1,99 @@
+package process
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/natesales/pathvector/pkg/config"
+	"github.com/natesales/pathvector/pkg/util"
+)
+
+// Peer relationships
+const (
+	relationshipCustomer = "customer"
+	relationshipPeer     = "peer"
+	relationshipUpstream = "upstream"
+	relationshipRS       = "rs"
+	relationshipInternal = "internal"
+)
+
+// relationshipIDs maps external peer relationships to the ID in the relationship community of imported routes
+var relationshipIDs = map[string]uint32{
+	relationshipCustomer: 1,
+	relationshipPeer:     2,
+	relationshipUpstream: 3,
+	relationshipRS:       4,
+}
+
+// relationshipRoles maps peer relationships to the RFC 9234 local BGP role
+var relationshipRoles = map[string]string{
+	relationshipCustomer: "provider",
+	relationshipPeer:     "peer",
+	relationshipUpstream: "customer",
+	relationshipRS:       "rs_client",
+}
+
+// applyRelationship sets the export and BGP role defaults of a peer's relationship, leaving explicitly configured values unchanged
+func applyRelationship(peerName string, peerData *config.Peer) error {
+	if peerData.Relationship == nil {
+		return nil
+	}
+	relationship := *peerData.Relationship
+	if _, found := relationshipIDs[relationship]; !found && relationship != relationshipInternal {
+		return fmt.Errorf("[%s] invalid relationship %s (must be one of customer, peer, upstream, rs, internal)", peerName, relationship)
+	}
+
+	// Customers and internal sessions receive all routes, everyone else only receives customer and originated routes
+	if peerData.AnnounceAll == nil {
+		peerData.AnnounceAll = util.Ptr(relationship == relationshipCustomer || relationship == relationshipInternal)
+	}
+
+	role, found := relationshipRoles[relationship]
+	if !found {
+		if peerData.Role != nil {
+			return fmt.Errorf("[%s] BGP role %s can't be used with relationship %s", peerName, *peerData.Role, relationship)
+		}
+		return nil
+	}
+	if peerData.Role == nil {
+		peerData.Role = util.Ptr(role)
+	} else if strings.ReplaceAll(*peerData.Role, "-", "_") != role {
+		return fmt.Errorf("[%s] BGP role %s is inconsistent with relationship %s (expected %s)", peerName, *peerData.Role, relationship, strings.ReplaceAll(role, "_", "-"))
+	}
+	return nil
+}
+
+// internalPeer returns true if a peer has the internal relationship, or has no relationship and the local ASN
+func internalPeer(c *config.Config, peerData *config.Peer) bool {
+	relationship := util.Deref(peerData.Relationship)
+	return relationship == relationshipInternal || (relationship == "" && *peerData.ASN == c.ASN)
+}
+
+// relationshipCommunities returns the relationship community patterns to remove from routes imported from a peer, the
+// relationship community to add, and the communities of routes to announce to the peer. Relationship communities are
+// removed from all eBGP peers so that peers without a relationship can't spoof them.
+func relationshipCommunities(c *config.Config, peerData *config.Peer) (remove []string, add []string, announce []string) {
+	if internalPeer(c, peerData) {
+		return nil, nil, nil
+	}
+	relationship := util.Deref(peerData.Relationship)
+	remove = []string{fmt.Sprintf("%d,%d,*", c.ASN, c.RelationshipFunction)}
+	if relationship == "" {
+		return remove, nil, nil
+	}
+	add = []string{fmt.Sprintf("%d,%d,%d", c.ASN, c.RelationshipFunction, relationshipIDs[relationship])}
+	if !util.Deref(peerData.AnnounceAll) {
+		announce = []string{fmt.Sprintf("%d,%d,%d", c.ASN, c.RelationshipFunction, relationshipIDs[relationshipCustomer])}
+	}
+	return remove, add, announce
+}
+
+// hasRelationships returns true if any peer has a relationship
+func hasRelationships(c *config.Config) bool {
+	for _, peerData := range c.Peers {
+		if peerData.Relationship != nil {
+			return true
+		}
+	}
+	return false
+}
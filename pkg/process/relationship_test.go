@@ -0,0 +1,90 @@
+package process
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRelationships(t *testing.T) {
+	configFile := `
+asn: 34553
+router-id: 192.0.2.1
+peers:
+  Customer:
+    asn: 65520
+    relationship: customer
+    neighbors: [ 203.0.113.1 ]
+  Peer:
+    asn: 65530
+    relationship: peer
+    role: peer
+    neighbors: [ 203.0.113.2 ]
+  Upstream:
+    asn: 65510
+    relationship: upstream
+    neighbors: [ 203.0.113.3 ]
+  Route Server:
+    asn: 65540
+    relationship: rs
+    neighbors: [ 203.0.113.4 ]
+  Internal:
+    asn: 34553
+    relationship: internal
+    neighbors: [ 192.0.2.2 ]
+  Other:
+    asn: 65550
+    neighbors: [ 203.0.113.5 ]
+`
+	c, err := Load([]byte(configFile))
+	assert.Nil(t, err)
+
+	for _, tc := range []struct {
+		peer        string
+		role        string
+		announceAll bool
+		imported    []string
+		announced   []string
+	}{
+		{"Customer", "provider", true, []string{"34553,4,1"}, []string{}},
+		{"Peer", "peer", false, []string{"34553,4,2"}, []string{"34553,4,1"}},
+		{"Upstream", "customer", false, []string{"34553,4,3"}, []string{"34553,4,1"}},
+		{"Route Server", "rs_client", false, []string{"34553,4,4"}, []string{"34553,4,1"}},
+	} {
+		t.Run(tc.peer, func(t *testing.T) {
+			peerData := c.Peers[tc.peer]
+			assert.Equal(t, tc.role, *peerData.Role)
+			assert.Equal(t, tc.announceAll, *peerData.AnnounceAll)
+			assert.Equal(t, []string{"34553,4,*"}, *peerData.RemoveLargeCommunities)
+			assert.Equal(t, tc.imported, *peerData.ImportLargeCommunities)
+			assert.Equal(t, tc.announced, *peerData.AnnounceLargeCommunities)
+		})
+	}
+
+	internal := c.Peers["Internal"]
+	assert.Nil(t, internal.Role)
+	assert.True(t, *internal.AnnounceAll)
+	assert.Empty(t, *internal.RemoveLargeCommunities)
+	assert.Empty(t, *internal.ImportLargeCommunities)
+
+	// Relationship communities are removed from eBGP peers without a relationship
+	other := c.Peers["Other"]
+	assert.Equal(t, []string{"34553,4,*"}, *other.RemoveLargeCommunities)
+	assert.Empty(t, *other.ImportLargeCommunities)
+	assert.False(t, *other.AnnounceAll)
+}
+
+func TestRelationshipsInvalid(t *testing.T) {
+	testLoadErrors(t, `
+asn: 34553
+router-id: 192.0.2.1
+peers:
+  Example:
+    asn: 65520
+    neighbors: [ 203.0.113.1 ]
+    `, []loadErrorTest{
+		{"unknown relationship", "relationship: sibling", "invalid relationship sibling"},
+		{"inconsistent role", "relationship: customer\n    role: customer", "inconsistent with relationship customer (expected provider)"},
+		{"internal role", "relationship: internal\n    role: peer", "can't be used with relationship internal"},
+	})
+}
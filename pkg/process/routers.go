@@ -0,0 +1,228 @@
+package process
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/creasty/defaults"
+	"gopkg.in/yaml.v3"
+
+	"github.com/natesales/pathvector/pkg/config"
+	"github.com/natesales/pathvector/pkg/util"
+)
+
+// iBGP router roles
+const (
+	routerRoleRR       = "rr"
+	routerRoleClient   = "client"
+	routerRoleFullMesh = "full-mesh"
+)
+
+// validateRouter sets the defaults of a router in the iBGP inventory and checks that its options are valid
+func validateRouter(hostname string, router *config.Router) error {
+	defaults.MustSet(router)
+	if router.Role != routerRoleRR && router.Role != routerRoleClient && router.Role != routerRoleFullMesh {
+		return fmt.Errorf("[router %s] invalid role %s (must be one of rr, client, full-mesh)", hostname, router.Role)
+	}
+	if router.Loopback4 == "" && router.Loopback6 == "" {
+		return fmt.Errorf("[router %s] at least one of loopback4 and loopback6 is required", hostname)
+	}
+	if router.Loopback4 != "" {
+		if ip := net.ParseIP(router.Loopback4); ip == nil || ip.To4() == nil {
+			return fmt.Errorf("[router %s] invalid loopback4 %s", hostname, router.Loopback4)
+		}
+	}
+	if router.Loopback6 != "" {
+		if ip := net.ParseIP(router.Loopback6); ip == nil || ip.To4() != nil {
+			return fmt.Errorf("[router %s] invalid loopback6 %s", hostname, router.Loopback6)
+		}
+	}
+	if router.ClusterID != "" {
+		if router.Role != routerRoleRR {
+			return fmt.Errorf("[router %s] cluster-id can only be set on rr routers", hostname)
+		}
+		if ip := net.ParseIP(router.ClusterID); ip == nil || ip.To4() == nil {
+			return fmt.Errorf("[router %s] invalid cluster-id %s (must be in dotted quad notation)", hostname, router.ClusterID)
+		}
+	}
+	return nil
+}
+
+// iBGPSession returns true if two routers have an iBGP session. Route reflector clients only have sessions with route
+// reflectors, and all other routers are fully meshed.
+func iBGPSession(local, remote *config.Router) bool {
+	if local.Role == routerRoleClient {
+		return remote.Role == routerRoleRR
+	}
+	if remote.Role == routerRoleClient {
+		return local.Role == routerRoleRR
+	}
+	return true
+}
+
+// parseRouters adds iBGP sessions with the routers in the inventory that the local router (matching the hostname) has
+// a session with in the topology
+func parseRouters(c *config.Config) error {
+	if len(c.Routers) == 0 {
+		return nil
+	}
+
+	hostnames := make([]string, 0, len(c.Routers))
+	for hostname, router := range c.Routers {
+		if err := validateRouter(hostname, router); err != nil {
+			return err
+		}
+		hostnames = append(hostnames, hostname)
+	}
+	sort.Strings(hostnames)
+
+	local, found := c.Routers[c.Hostname]
+	if !found {
+		return fmt.Errorf("hostname %s not found in routers", c.Hostname)
+	}
+	if c.IBGPTemplate != "" {
+		if _, found := c.Templates[c.IBGPTemplate]; !found {
+			return fmt.Errorf("ibgp-template %s not found", c.IBGPTemplate)
+		}
+	}
+
+	for _, hostname := range hostnames {
+		if _, found := c.Peers[hostname]; found {
+			return fmt.Errorf("router %s has the same name as a configured peer", hostname)
+		}
+		remote := c.Routers[hostname]
+		if hostname == c.Hostname || !iBGPSession(local, remote) {
+			continue
+		}
+
+		var neighbors []string
+		if local.Loopback4 != "" && remote.Loopback4 != "" {
+			neighbors = append(neighbors, remote.Loopback4)
+		}
+		if local.Loopback6 != "" && remote.Loopback6 != "" {
+			neighbors = append(neighbors, remote.Loopback6)
+		}
+		if len(neighbors) == 0 {
+			return fmt.Errorf("routers %s and %s have no loopback address family in common", c.Hostname, hostname)
+		}
+
+		peerData := &config.Peer{
+			Description: util.Ptr(fmt.Sprintf("iBGP %s %s", remote.Role, hostname)),
+			ASN:         util.Ptr(c.ASN),
+			NeighborIPs: &neighbors,
+		}
+		if local.Loopback4 != "" {
+			peerData.Listen4 = util.Ptr(local.Loopback4)
+		}
+		if local.Loopback6 != "" {
+			peerData.Listen6 = util.Ptr(local.Loopback6)
+		}
+		if local.Role == routerRoleRR && remote.Role == routerRoleClient {
+			peerData.RRClient = util.Ptr(true)
+			if local.ClusterID != "" {
+				peerData.RRClusterID = util.Ptr(local.ClusterID)
+			}
+		}
+		if c.IBGPTemplate != "" {
+			peerData.Template = util.Ptr(c.IBGPTemplate)
+		}
+		c.Peers[hostname] = peerData
+	}
+	return nil
+}
+
+// applyIBGP sets the defaults of iBGP sessions generated from the router inventory, leaving values configured in the
+// ibgp-template unchanged
+func applyIBGP(c *config.Config, peerName string, peerData *config.Peer) {
+	if c.Routers[peerName] == nil {
+		return
+	}
+	if peerData.AnnounceAll == nil {
+		peerData.AnnounceAll = util.Ptr(true)
+	}
+
+	// Routes learned from eBGP peers are announced with this router as the next hop, reflected routes keep theirs
+	if peerData.NextHopSelfEBGP == nil {
+		peerData.NextHopSelfEBGP = util.Ptr(true)
+	}
+
+	// Keep iBGP routes unchanged
+	if peerData.SetLocalPref == nil {
+		peerData.SetLocalPref = util.Ptr(false)
+	}
+	if peerData.RemovePrivateASNs == nil {
+		peerData.RemovePrivateASNs = util.Ptr(false)
+	}
+	if peerData.EnforceFirstAS == nil {
+		peerData.EnforceFirstAS = util.Ptr(false)
+	}
+	if peerData.EnforcePeerNexthop == nil {
+		peerData.EnforcePeerNexthop = util.Ptr(false)
+	}
+	if peerData.FilterPrefixLength == nil {
+		peerData.FilterPrefixLength = util.Ptr(false)
+	}
+}
+
+// mergeOverrides returns a copy of a YAML mapping with overrides applied. Nested mappings are merged and all other
+// values, including lists, are replaced.
+func mergeOverrides(base, overrides map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(base))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range overrides {
+		baseMap, baseIsMap := merged[key].(map[string]interface{})
+		overrideMap, overrideIsMap := value.(map[string]interface{})
+		if baseIsMap && overrideIsMap {
+			merged[key] = mergeOverrides(baseMap, overrideMap)
+		} else {
+			merged[key] = value
+		}
+	}
+	return merged
+}
+
+// RouterConfigs returns the config file of each router in the inventory with its overrides applied and hostname set
+func RouterConfigs(configBlob []byte) (map[string][]byte, error) {
+	var base map[string]interface{}
+	if err := yaml.Unmarshal(configBlob, &base); err != nil {
+		return nil, fmt.Errorf("YAML unmarshal: %s", err)
+	}
+	routers, ok := base["routers"].(map[string]interface{})
+	if !ok || len(routers) == 0 {
+		return nil, fmt.Errorf("no routers defined")
+	}
+
+	configs := map[string][]byte{}
+	for hostname, routerData := range routers {
+		if hostname == "" || hostname == "." || hostname == ".." || strings.ContainsAny(hostname, `/\`) {
+			return nil, fmt.Errorf("invalid router hostname %q", hostname)
+		}
+		router, ok := routerData.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("[router %s] invalid router", hostname)
+		}
+		merged := base
+		if overrides, found := router["overrides"]; found {
+			overridesMap, ok := overrides.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("[router %s] overrides must be a map of config options", hostname)
+			}
+			if _, found := overridesMap["routers"]; found {
+				return nil, fmt.Errorf("[router %s] routers can't be overridden", hostname)
+			}
+			merged = mergeOverrides(base, overridesMap)
+		}
+		merged = mergeOverrides(merged, map[string]interface{}{"hostname": hostname})
+
+		configBlob, err := yaml.Marshal(merged)
+		if err != nil {
+			return nil, fmt.Errorf("[router %s] YAML marshal: %s", hostname, err)
+		}
+		configs[hostname] = configBlob
+	}
+	return configs, nil
+}
@@ -0,0 +1,255 @@
+package process
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/natesales/pathvector/pkg/healthcheck"
+)
+
+const routersConfig = `
+asn: 34553
+router-id: 192.0.2.1
+hostname: %s
+ibgp-template: internal
+templates:
+  internal:
+    password: secret
+    bfd: true
+    enforce-peer-nexthop: true
+routers:
+  rr1:
+    role: rr
+    cluster-id: 10.0.0.1
+    loopback4: 10.0.0.1
+    loopback6: 2001:db8::1
+  rr2:
+    role: rr
+    cluster-id: 10.0.0.1
+    loopback4: 10.0.0.2
+    loopback6: 2001:db8::2
+  edge1:
+    loopback4: 10.0.0.3
+  client1:
+    role: client
+    loopback4: 10.0.0.4
+    loopback6: 2001:db8::4
+  client2:
+    role: client
+    loopback6: 2001:db8::5
+peers:
+  Upstream:
+    asn: 65510
+    neighbors: [ 203.0.113.1 ]
+`
+
+func TestRouters(t *testing.T) {
+	for _, tc := range []struct {
+		hostname string
+		peers    []string
+	}{
+		{"rr1", []string{"Upstream", "client1", "client2", "edge1", "rr2"}},
+		{"edge1", []string{"Upstream", "rr1", "rr2"}},
+		{"client1", []string{"Upstream", "rr1", "rr2"}},
+		{"client2", []string{"Upstream", "rr1", "rr2"}},
+	} {
+		t.Run(tc.hostname, func(t *testing.T) {
+			c, err := Load([]byte(fmt.Sprintf(routersConfig, tc.hostname)))
+			assert.Nil(t, err)
+			var peers []string
+			for peerName := range c.Peers {
+				peers = append(peers, peerName)
+			}
+			sort.Strings(peers)
+			assert.Equal(t, tc.peers, peers)
+		})
+	}
+
+	c, err := Load([]byte(fmt.Sprintf(routersConfig, "rr1")))
+	assert.Nil(t, err)
+
+	client := c.Peers["client1"]
+	assert.Equal(t, 34553, *client.ASN)
+	assert.Equal(t, []string{"10.0.0.4", "2001:db8::4"}, *client.NeighborIPs)
+	assert.Equal(t, "10.0.0.1", *client.Listen4)
+	assert.Equal(t, "2001:db8::1", *client.Listen6)
+	assert.True(t, *client.RRClient)
+	assert.Equal(t, "10.0.0.1", *client.RRClusterID)
+	assert.True(t, *client.NextHopSelfEBGP)
+	assert.False(t, *client.NextHopSelf)
+	assert.True(t, *client.AnnounceAll)
+	assert.False(t, *client.SetLocalPref)
+	assert.False(t, *client.EnforceFirstAS)
+	assert.True(t, *client.EnforcePeerNexthop)
+	assert.False(t, *client.FilterPrefixLength)
+	assert.Equal(t, "secret", *client.Password)
+	assert.True(t, *client.BFD)
+
+	assert.Equal(t, []string{"2001:db8::5"}, *c.Peers["client2"].NeighborIPs)
+	assert.Equal(t, []string{"10.0.0.3"}, *c.Peers["edge1"].NeighborIPs)
+	assert.False(t, *c.Peers["edge1"].RRClient)
+	assert.Nil(t, c.Peers["edge1"].RRClusterID)
+	assert.False(t, *c.Peers["rr2"].RRClient)
+
+	peer := renderTest(t, c)["AS34553_CLIENT1.conf"]
+	assert.Contains(t, peer, "rr client;")
+	assert.Contains(t, peer, "rr cluster id 10.0.0.1;")
+	assert.Contains(t, peer, "next hop self ebgp;")
+}
+
+func TestRoutersInvalid(t *testing.T) {
+	testLoadErrors(t, "asn: 34553\nrouter-id: 192.0.2.1\nhostname: rr1\nrouters:\n", []loadErrorTest{
+		{"unknown hostname", "  other:\n    loopback4: 10.0.0.1", "hostname rr1 not found in routers"},
+		{"invalid role", "  rr1:\n    role: spine\n    loopback4: 10.0.0.1", "invalid role spine"},
+		{"no loopback", "  rr1:\n    role: rr", "at least one of loopback4 and loopback6 is required"},
+		{"invalid loopback", "  rr1:\n    loopback4: 2001:db8::1", "invalid loopback4 2001:db8::1"},
+		{"cluster ID on client", "  rr1:\n    role: client\n    cluster-id: 10.0.0.1\n    loopback4: 10.0.0.1", "cluster-id can only be set on rr routers"},
+		{"no common address family", "  rr1:\n    loopback4: 10.0.0.1\n  rr2:\n    loopback6: 2001:db8::2", "no loopback address family in common"},
+		{"peer name", "  rr1:\n    loopback4: 10.0.0.1\npeers:\n  rr1:\n    asn: 65510\n    neighbors: [ 203.0.113.1 ]", "router rr1 has the same name as a configured peer"},
+	})
+}
+
+const routersOverridesConfig = `
+asn: 34553
+router-id: 192.0.2.1
+prefixes: [ 192.0.2.0/24 ]
+routers:
+  rr1:
+    role: rr
+    loopback4: 10.0.0.1
+    overrides:
+      router-id: 10.0.0.1
+      peers:
+        Upstream:
+          asn: 65510
+          neighbors: [ 203.0.113.1 ]
+  edge1:
+    loopback4: 10.0.0.2
+    overrides:
+      router-id: 10.0.0.2
+      prefixes: [ 198.51.100.0/24 ]
+peers:
+  Peer:
+    asn: 65520
+    neighbors: [ 203.0.113.2 ]
+`
+
+func TestRouterConfigs(t *testing.T) {
+	configs, err := RouterConfigs([]byte(routersOverridesConfig))
+	assert.Nil(t, err)
+	assert.Len(t, configs, 2)
+
+	rr1, err := Load(configs["rr1"])
+	assert.Nil(t, err)
+	assert.Equal(t, "rr1", rr1.Hostname)
+	assert.Equal(t, "10.0.0.1", rr1.RouterID)
+	assert.Equal(t, []string{"192.0.2.0/24"}, rr1.Prefixes)
+	assert.Len(t, rr1.Peers, 3)
+	assert.Contains(t, rr1.Peers, "Upstream")
+	assert.Contains(t, rr1.Peers, "Peer")
+	assert.Contains(t, rr1.Peers, "edge1")
+
+	edge1, err := Load(configs["edge1"])
+	assert.Nil(t, err)
+	assert.Equal(t, "edge1", edge1.Hostname)
+	assert.Equal(t, "10.0.0.2", edge1.RouterID)
+	assert.Equal(t, []string{"198.51.100.0/24"}, edge1.Prefixes)
+	assert.Len(t, edge1.Peers, 2)
+	assert.Contains(t, edge1.Peers, "Peer")
+	assert.Contains(t, edge1.Peers, "rr1")
+
+	for _, tc := range []struct {
+		name   string
+		config string
+		err    string
+	}{
+		{"no routers", "asn: 34553\n", "no routers defined"},
+		{"invalid overrides", "routers:\n  rr1:\n    overrides: [ a ]\n", "overrides must be a map of config options"},
+		{"routers override", "routers:\n  rr1:\n    overrides:\n      routers: {}\n", "routers can't be overridden"},
+		{"invalid hostname", "routers:\n  ../rr1:\n    loopback4: 10.0.0.1\n", "invalid router hostname"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := RouterConfigs([]byte(tc.config))
+			assert.ErrorContains(t, err, tc.err)
+		})
+	}
+}
+
+func TestRunAll(t *testing.T) {
+	configFile := path.Join(t.TempDir(), "pathvector.yml")
+	assert.Nil(t, os.WriteFile(configFile, []byte(routersOverridesConfig), 0644))
+	output := t.TempDir()
+	RunAll(configFile, output, "", "test", false)
+
+	for _, tc := range []struct {
+		hostname string
+		routerID string
+		files    []string
+	}{
+		{"rr1", "10.0.0.1", []string{"AS34553_EDGE1.conf", "AS65510_UPSTREAM.conf", "AS65520_PEER.conf"}},
+		{"edge1", "10.0.0.2", []string{"AS34553_RR1.conf", "AS65520_PEER.conf"}},
+	} {
+		t.Run(tc.hostname, func(t *testing.T) {
+			files, err := filepath.Glob(path.Join(output, tc.hostname, "AS*.conf"))
+			assert.Nil(t, err)
+			for i := range files {
+				files[i] = filepath.Base(files[i])
+			}
+			assert.Equal(t, tc.files, files)
+
+			global, err := os.ReadFile(path.Join(output, tc.hostname, "bird.conf"))
+			assert.Nil(t, err)
+			assert.Contains(t, string(global), "router id "+tc.routerID+";")
+
+			config, err := os.ReadFile(path.Join(output, tc.hostname, "pathvector.yml"))
+			assert.Nil(t, err)
+			assert.Contains(t, string(config), "hostname: "+tc.hostname)
+		})
+	}
+}
+
+func TestRunAllState(t *testing.T) {
+	configFile := path.Join(t.TempDir(), "pathvector.yml")
+	assert.Nil(t, os.WriteFile(configFile, []byte(routersOverridesConfig+`
+anycast:
+  198.18.0.0/24:
+    type: command
+    target: "true"
+`), 0644))
+
+	state := t.TempDir()
+	assert.Nil(t, os.MkdirAll(path.Join(state, "rr1"), 0755))
+	for file, contents := range map[string]string{
+		healthcheck.StateFile: `{"198.18.0.0/24": true}`,
+		BlackholeFile:         `{"192.0.2.10/32": {"peers": [], "expires": "2099-01-01T00:00:00Z"}}`,
+		"protocols.json":      `{"PEER_AS65520_v4_1": {"Name": "Peer", "ASN": 65520, "Neighbor": "203.0.113.2", "Family": "4"}}`,
+		"manual-test.conf":    "# Manual config\n",
+	} {
+		assert.Nil(t, os.WriteFile(path.Join(state, "rr1", file), []byte(contents), 0644))
+	}
+
+	output := t.TempDir()
+	RunAll(configFile, output, state, "test", false)
+
+	global, err := os.ReadFile(path.Join(output, "rr1", "bird.conf"))
+	assert.Nil(t, err)
+	assert.Contains(t, string(global), "protocol static ANYCAST_198_18_0_0_24 {\n  ipv4;")
+	assert.Contains(t, string(global), "route 192.0.2.10/32 blackhole")
+	peer, err := os.ReadFile(path.Join(output, "rr1", "AS65520_PEER.conf"))
+	assert.Nil(t, err)
+	assert.Contains(t, string(peer), "protocol bgp PEER_AS65520_v4_1 {")
+	_, err = os.Stat(path.Join(output, "rr1", "manual-test.conf"))
+	assert.Nil(t, err)
+
+	// Routers without state are rendered without runtime state
+	global, err = os.ReadFile(path.Join(output, "edge1", "bird.conf"))
+	assert.Nil(t, err)
+	assert.Contains(t, string(global), "protocol static ANYCAST_198_18_0_0_24 {\n  disabled;")
+	assert.NotContains(t, string(global), "192.0.2.10/32")
+}
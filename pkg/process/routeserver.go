@@ -0,0 +1,108 @@
+package process
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/natesales/pathvector/pkg/config"
+	"github.com/natesales/pathvector/pkg/util"
+)
+
+// Route server action community functions
+const (
+	rsDontAnnounce    = 0     // 0:peer-as and rs-asn:0:peer-as
+	rsAnnounce        = 1     // rs-asn:1:peer-as
+	rsPrependStandard = 65500 // 6550x:peer-as prepends x times
+	rsPrependLarge    = 100   // rs-asn:10x:peer-as prepends x times
+	rsMaxPrepends     = 3
+)
+
+// applyRouteServer sets the route server client defaults of external peers in route server mode, leaving explicitly
+// configured values unchanged
+func applyRouteServer(c *config.Config, peerData *config.Peer) {
+	if !c.RouteServer.Enable || util.Deref(peerData.ASN) == c.ASN {
+		return
+	}
+	if peerData.RSClient == nil {
+		peerData.RSClient = util.Ptr(true)
+	}
+	if !*peerData.RSClient {
+		return
+	}
+
+	// Route servers announce all accepted routes with their AS paths intact
+	if peerData.AnnounceAll == nil {
+		peerData.AnnounceAll = util.Ptr(true)
+	}
+	if peerData.RemovePrivateASNs == nil {
+		peerData.RemovePrivateASNs = util.Ptr(false)
+	}
+	if peerData.Role == nil {
+		peerData.Role = util.Ptr("rs_server")
+	}
+}
+
+// routeServerDescription returns a looking glass friendly session description starting with the peer's ASN
+func routeServerDescription(peerName string, peerData *config.Peer) string {
+	prefix := fmt.Sprintf("AS%d", *peerData.ASN)
+	description := util.Deref(peerData.Description)
+	if description == "" {
+		description = peerName
+	}
+	description = strings.ReplaceAll(description, `"`, "'")
+	if strings.HasPrefix(description, prefix+" ") {
+		return description
+	}
+	return prefix + " " + description
+}
+
+// routeServerActions returns the route server action communities interpreted when exporting routes to a route server
+// client. Standard communities are only included when the ASNs fit in 16 bits.
+func routeServerActions(c *config.Config, peerData *config.Peer) ([]config.ExportAction, *config.RouteServerPolicy) {
+	peerASN := *peerData.ASN
+	rsStandard := c.ASN <= math.MaxUint16
+	peerStandard := peerASN <= math.MaxUint16
+
+	var actions []config.ExportAction
+	policy := &config.RouteServerPolicy{}
+
+	// Don't announce to the peer
+	if peerStandard {
+		actions = append(actions, config.ExportAction{Community: fmt.Sprintf("%d,%d", rsDontAnnounce, peerASN), NoExport: true, Prepend: util.Ptr(0)})
+	}
+	actions = append(actions, config.ExportAction{Community: fmt.Sprintf("%d,%d,%d", c.ASN, rsDontAnnounce, peerASN), Large: true, NoExport: true, Prepend: util.Ptr(0)})
+
+	// Prepend when announcing to the peer
+	for i := 1; i <= rsMaxPrepends; i++ {
+		if peerStandard {
+			actions = append(actions, config.ExportAction{Community: fmt.Sprintf("%d,%d", rsPrependStandard+i, peerASN), Prepend: util.Ptr(i)})
+		}
+		actions = append(actions, config.ExportAction{Community: fmt.Sprintf("%d,%d,%d", c.ASN, rsPrependLarge+i, peerASN), Large: true, Prepend: util.Ptr(i)})
+	}
+
+	// Don't announce to any client, unless explicitly announced to the peer
+	if rsStandard {
+		policy.AnnounceNone = append(policy.AnnounceNone, config.ExportAction{Community: fmt.Sprintf("%d,%d", rsDontAnnounce, c.ASN)})
+		if peerStandard {
+			policy.Announce = append(policy.Announce, config.ExportAction{Community: fmt.Sprintf("%d,%d", c.ASN, peerASN)})
+		}
+	}
+	policy.AnnounceNone = append(policy.AnnounceNone, config.ExportAction{Community: fmt.Sprintf("%d,%d,0", c.ASN, rsDontAnnounce), Large: true})
+	policy.Announce = append(policy.Announce, config.ExportAction{Community: fmt.Sprintf("%d,%d,%d", c.ASN, rsAnnounce, peerASN), Large: true})
+
+	// Action communities are removed before routes are announced
+	policy.RemoveStandard = []string{fmt.Sprintf("%d,*", rsDontAnnounce)}
+	for i := 1; i <= rsMaxPrepends; i++ {
+		policy.RemoveStandard = append(policy.RemoveStandard, fmt.Sprintf("%d,*", rsPrependStandard+i))
+	}
+	if rsStandard {
+		policy.RemoveStandard = append(policy.RemoveStandard, fmt.Sprintf("%d,*", c.ASN))
+	}
+	policy.RemoveLarge = []string{fmt.Sprintf("%d,%d,*", c.ASN, rsDontAnnounce), fmt.Sprintf("%d,%d,*", c.ASN, rsAnnounce)}
+	for i := 1; i <= rsMaxPrepends; i++ {
+		policy.RemoveLarge = append(policy.RemoveLarge, fmt.Sprintf("%d,%d,*", c.ASN, rsPrependLarge+i))
+	}
+
+	return actions, policy
+}
@@ -0,0 +1,105 @@
+package process
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/natesales/pathvector/pkg/config"
+	"github.com/natesales/pathvector/pkg/util"
+)
+
+func TestRouteServer(t *testing.T) {
+	c, err := Load([]byte(`
+asn: 64500
+router-id: 192.0.2.1
+route-server:
+  enable: true
+peers:
+  Example:
+    asn: 65510
+    description: Example Networks
+    neighbors: [ 203.0.113.1 ]
+  Large:
+    asn: 4200000000
+    neighbors: [ 203.0.113.2 ]
+  Monitoring:
+    asn: 65520
+    rs-client: false
+    neighbors: [ 203.0.113.3 ]
+  Internal:
+    asn: 64500
+    neighbors: [ 192.0.2.2 ]
+`))
+	assert.Nil(t, err)
+
+	example := c.Peers["Example"]
+	assert.True(t, *example.RSClient)
+	assert.True(t, *example.AnnounceAll)
+	assert.False(t, *example.RemovePrivateASNs)
+	assert.Equal(t, "rs_server", *example.Role)
+	assert.Equal(t, "AS65510 Example Networks", *example.Description)
+	assert.Equal(t, "AS4200000000 Large", *c.Peers["Large"].Description)
+
+	assert.False(t, *c.Peers["Monitoring"].RSClient)
+	assert.Nil(t, c.Peers["Monitoring"].Description)
+	assert.Nil(t, c.Peers["Internal"].Description)
+	assert.Nil(t, c.Peers["Monitoring"].RouteServerPolicy)
+	assert.False(t, *c.Peers["Internal"].RSClient)
+	assert.Nil(t, c.Peers["Internal"].RouteServerPolicy)
+
+	assert.Equal(t, []config.ExportAction{
+		{Community: "0,65510", NoExport: true, Prepend: util.Ptr(0)},
+		{Community: "64500,0,65510", Large: true, NoExport: true, Prepend: util.Ptr(0)},
+		{Community: "65501,65510", Prepend: util.Ptr(1)},
+		{Community: "64500,101,65510", Large: true, Prepend: util.Ptr(1)},
+		{Community: "65502,65510", Prepend: util.Ptr(2)},
+		{Community: "64500,102,65510", Large: true, Prepend: util.Ptr(2)},
+		{Community: "65503,65510", Prepend: util.Ptr(3)},
+		{Community: "64500,103,65510", Large: true, Prepend: util.Ptr(3)},
+	}, *example.ExportActions)
+	assert.Equal(t, &config.RouteServerPolicy{
+		AnnounceNone:   []config.ExportAction{{Community: "0,64500"}, {Community: "64500,0,0", Large: true}},
+		Announce:       []config.ExportAction{{Community: "64500,65510"}, {Community: "64500,1,65510", Large: true}},
+		RemoveStandard: []string{"0,*", "65501,*", "65502,*", "65503,*", "64500,*"},
+		RemoveLarge:    []string{"64500,0,*", "64500,1,*", "64500,101,*", "64500,102,*", "64500,103,*"},
+	}, example.RouteServerPolicy)
+
+	// 32-bit clients only have large communities
+	large := c.Peers["Large"]
+	for _, action := range *large.ExportActions {
+		assert.True(t, action.Large)
+	}
+	assert.Equal(t, []config.ExportAction{{Community: "64500,1,4200000000", Large: true}}, large.RouteServerPolicy.Announce)
+
+	peer := renderTest(t, c)["AS65510_EXAMPLE.conf"]
+	assert.Contains(t, peer, `description "AS65510 Example Networks";`)
+	assert.Contains(t, peer, "rs client;")
+	assert.Contains(t, peer, `if (((0,64500) ~ bgp_community || (64500,0,0) ~ bgp_large_community) && !((64500,65510) ~ bgp_community || (64500,1,65510) ~ bgp_large_community)) then _reject("route server action community: not announced to any client");`)
+	assert.Contains(t, peer, `if ((0,65510) ~ bgp_community) then _reject("action community 0,65510");`)
+	assert.Contains(t, peer, "bgp_path.prepend(bgp_path.first);")
+	assert.NotContains(t, peer, "bgp_path.prepend(ASN);")
+	assert.Contains(t, peer, "bgp_community.delete([(0,*), (65501,*), (65502,*), (65503,*), (64500,*)]);")
+	assert.Contains(t, peer, "bgp_large_community.delete([(64500,0,*), (64500,1,*), (64500,101,*), (64500,102,*), (64500,103,*)]);")
+}
+
+func TestRouteServerOptions(t *testing.T) {
+	c, err := Load([]byte(`
+asn: 64500
+router-id: 192.0.2.1
+route-server:
+  enable: true
+  action-communities: false
+  descriptions: false
+peers:
+  Example:
+    asn: 65510
+    description: AS65510 Example Networks
+    neighbors: [ 203.0.113.1 ]
+`))
+	assert.Nil(t, err)
+	assert.True(t, *c.Peers["Example"].RSClient)
+	assert.Nil(t, c.Peers["Example"].RouteServerPolicy)
+	assert.Empty(t, *c.Peers["Example"].ExportActions)
+	assert.Equal(t, "AS65510 Example Networks", routeServerDescription("Example", c.Peers["Example"]))
+}
@@ -2,25 +2,22 @@ package templating
 
 import (
 	"embed"
+	"encoding/json"
 	"fmt"
+	"net"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
-	"sync"
 	"text/template"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 
 	"github.com/natesales/pathvector/pkg/config"
-	"github.com/natesales/pathvector/pkg/util"
 )
 
-var (
-	protocolNames       []string
-	protocolNameMap     = map[string]*Protocol{} // bird name:protocol
-	protocolNameMapLock = sync.Mutex{}
-)
+var protocolNameMap = map[string]*Protocol{} // bird name:protocol
 
 // Wrapper is passed to the peer template
 type Wrapper struct {
@@ -29,9 +26,14 @@ type Wrapper struct {
 	Config config.Config
 }
 
+// Protocol is a protocol name map entry, keyed by BIRD protocol name in protocols.json.
+// ASN, Neighbor and Family identify the session so its name can be reused across config edits.
 type Protocol struct {
-	Name string
-	Tags []string
+	Name     string
+	Tags     []string
+	ASN      int
+	Neighbor string
+	Family   string
 }
 
 // ProtocolNames gets a map of protocol names to user defined names
@@ -39,6 +41,139 @@ func ProtocolNames() map[string]*Protocol {
 	return protocolNameMap
 }
 
+// LoadProtocolNames reads a protocol name map written by a previous run
+func LoadProtocolNames(file string) (map[string]*Protocol, error) {
+	contents, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var protocols map[string]*Protocol
+	if err := json.Unmarshal(contents, &protocols); err != nil {
+		return nil, err
+	}
+	return protocols, nil
+}
+
+// AllocateProtocolNames assigns a unique BIRD protocol name to every neighbor of every peer.
+// Peers are processed in sorted order so the allocation doesn't depend on map iteration order,
+// and names from a previous allocation are reused for sessions with the same ASN, neighbor and
+// address family, so renaming or reordering peers doesn't cause BIRD to restart their sessions.
+// Names written before session identities were stored are reused for peers with the same name.
+func AllocateProtocolNames(peers map[string]*config.Peer, previous map[string]*Protocol) {
+	protocolNameMap = map[string]*Protocol{}
+
+	var peerNames []string
+	for peerName := range peers {
+		peerNames = append(peerNames, peerName)
+	}
+	sort.Strings(peerNames)
+
+	// Index previous allocations by session identity
+	previousNames := map[string]string{}
+	var previousProtoNames []string
+	for protoName := range previous {
+		previousProtoNames = append(previousProtoNames, protoName)
+	}
+	sort.Strings(previousProtoNames)
+	for _, protoName := range previousProtoNames {
+		p := previous[protoName]
+		if p == nil {
+			continue
+		}
+		if p.Neighbor == "" { // Written before session identities were stored, fall back to the peer name
+			previousNames["name "+p.Name+" "+protoName] = protoName
+			continue
+		}
+		id := sessionIdentity(p.ASN, p.Neighbor, p.Family)
+		if _, found := previousNames[id]; !found {
+			previousNames[id] = protoName
+		}
+	}
+
+	// Reserve names from the previous allocation first, so new sessions can't take them
+	for _, peerName := range peerNames {
+		peerData := peers[peerName]
+		protocols := make([]string, len(*peerData.NeighborIPs))
+		familyIndex := map[string]int{}
+		for i, neighbor := range *peerData.NeighborIPs {
+			family := neighborFamily(neighbor)
+			protoName, ok := previousNames[sessionIdentity(*peerData.ASN, neighbor, family)]
+			if !ok {
+				// Names without session identities were allocated in neighbor order within each address family
+				legacyName := protocolBaseName(peerData, neighbor)
+				if familyIndex[family] > 0 {
+					legacyName = fmt.Sprintf("%s_%d", legacyName, familyIndex[family])
+				}
+				protoName, ok = previousNames["name "+peerName+" "+legacyName]
+			}
+			familyIndex[family]++
+			if ok {
+				if _, taken := protocolNameMap[protoName]; !taken {
+					protocols[i] = protoName
+					protocolNameMap[protoName] = newProtocol(peerName, neighbor, peerData)
+				}
+			}
+		}
+		peerData.Protocols = &protocols
+	}
+
+	// Allocate the lowest free name to all remaining sessions
+	for _, peerName := range peerNames {
+		peerData := peers[peerName]
+		for i, neighbor := range *peerData.NeighborIPs {
+			if (*peerData.Protocols)[i] != "" {
+				continue
+			}
+			base := protocolBaseName(peerData, neighbor)
+			protoName := base
+			for n := 1; ; n++ {
+				if _, taken := protocolNameMap[protoName]; !taken {
+					break
+				}
+				protoName = fmt.Sprintf("%s_%d", base, n)
+			}
+			(*peerData.Protocols)[i] = protoName
+			protocolNameMap[protoName] = newProtocol(peerName, neighbor, peerData)
+		}
+	}
+}
+
+// neighborFamily returns the address family of a neighbor address
+func neighborFamily(neighbor string) string {
+	if strings.Contains(neighbor, ":") {
+		return "6"
+	}
+	return "4"
+}
+
+// sessionIdentity returns a key identifying a BGP session independently of the peer's name
+func sessionIdentity(asn int, neighbor, family string) string {
+	if ip := net.ParseIP(neighbor); ip != nil {
+		neighbor = ip.String()
+	}
+	return fmt.Sprintf("AS%d %s v%s", asn, neighbor, family)
+}
+
+// protocolBaseName returns the protocol name for a neighbor before any uniqueness suffix is added
+func protocolBaseName(peerData *config.Peer, neighbor string) string {
+	return fmt.Sprintf("%s_AS%d_v%s", *peerData.ProtocolName, *peerData.ASN, neighborFamily(neighbor))
+}
+
+// newProtocol creates a protocol name map entry for a peer's neighbor
+func newProtocol(peerName, neighbor string, peerData *config.Peer) *Protocol {
+	var t []string
+	if peerData.Tags != nil {
+		t = *peerData.Tags
+	}
+	return &Protocol{
+		Name:     peerName,
+		Tags:     t,
+		ASN:      *peerData.ASN,
+		Neighbor: neighbor,
+		Family:   neighborFamily(neighbor),
+	}
+}
+
 // Template functions
 var funcMap = template.FuncMap{
 	"Contains": strings.Contains,
@@ -191,28 +326,12 @@ var funcMap = template.FuncMap{
 		return ""
 	},
 
-	// UniqueProtocolName takes a protocol-safe string and address family and returns a unique protocol name
-	"UniqueProtocolName": func(s, userSuppliedName *string, af string, asn *int, tags *[]string) string {
-		protoName := fmt.Sprintf("%s_AS%d_v%s", *s, *asn, af)
-		i := 1
-		for {
-			if !util.Contains(protocolNames, protoName) {
-				protocolNames = append(protocolNames, protoName)
-				var t []string
-				if tags != nil {
-					t = *tags
-				}
-				protocolNameMapLock.Lock()
-				protocolNameMap[protoName] = &Protocol{
-					Name: *userSuppliedName,
-					Tags: t,
-				}
-				protocolNameMapLock.Unlock()
-				return protoName
-			}
-			protoName = fmt.Sprintf("%s_AS%d_v%s_%d", *s, *asn, af, i)
-			i++
+	// ProtocolName returns the allocated BIRD protocol name for a peer's neighbor index
+	"ProtocolName": func(protocols *[]string, i int) string {
+		if protocols == nil || i >= len(*protocols) {
+			return "# CODE ERROR: protocol name not allocated. This should never happen."
 		}
+		return (*protocols)[i]
 	},
 
 	"SplitFirst": func(s string, delim string) string {
@@ -1,8 +1,12 @@
 package templating
 
 import (
+	"os"
+	"path"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
+
 	"github.com/natesales/pathvector/pkg/config"
 	"github.com/natesales/pathvector/pkg/embed"
 )
@@ -24,3 +28,56 @@ func TestWriteBlankVRRPConfig(t *testing.T) {
 func TestWriteVRRPConfig(t *testing.T) {
 	WriteVRRPConfig(map[string]*config.VRRPInstance{"VRRP 1": {State: "primary"}}, "/tmp/pathvector-go-test-keepalived.conf")
 }
+
+func testPeer(name string, asn int, neighbors ...string) *config.Peer {
+	return &config.Peer{
+		ProtocolName: &name,
+		ASN:          &asn,
+		NeighborIPs:  &neighbors,
+	}
+}
+
+func TestAllocateProtocolNamesStable(t *testing.T) {
+	AllocateProtocolNames(map[string]*config.Peer{
+		"Example": testPeer("EXAMPLE", 65510, "203.0.113.1", "2001:db8::1"),
+		"Other":   testPeer("OTHER", 65520, "203.0.113.2"),
+	}, nil)
+	previous := ProtocolNames()
+	assert.Len(t, previous, 3)
+	assert.Equal(t, &Protocol{Name: "Example", ASN: 65510, Neighbor: "2001:db8::1", Family: "6"}, previous["EXAMPLE_AS65510_v6"])
+
+	// Rename a peer, change the ASN of another, and add a new peer that would take the renamed peer's base name
+	renamed := testPeer("RENAMED", 65510, "2001:db8:0::1", "203.0.113.1")
+	other := testPeer("OTHER", 65530, "203.0.113.2")
+	example := testPeer("EXAMPLE", 65510, "203.0.113.3")
+	AllocateProtocolNames(map[string]*config.Peer{
+		"Renamed": renamed,
+		"Other":   other,
+		"Example": example,
+	}, previous)
+
+	assert.Equal(t, []string{"EXAMPLE_AS65510_v6", "EXAMPLE_AS65510_v4"}, *renamed.Protocols)
+	assert.Equal(t, []string{"OTHER_AS65530_v4"}, *other.Protocols)
+	assert.Equal(t, []string{"EXAMPLE_AS65510_v4_1"}, *example.Protocols)
+	assert.Equal(t, "Renamed", ProtocolNames()["EXAMPLE_AS65510_v4"].Name)
+}
+
+func TestAllocateProtocolNamesLegacy(t *testing.T) {
+	// Protocol names written before session identities were stored only have the peer name and tags
+	file := path.Join(t.TempDir(), "protocols.json")
+	assert.Nil(t, os.WriteFile(file, []byte(`{
+  "EXAMPLE_AS65510_v4": {"Name": "Example", "Tags": ["transit"]},
+  "EXAMPLE_AS65510_v4_1": {"Name": "Example", "Tags": ["transit"]},
+  "EXAMPLE_AS65510_v6": {"Name": "Example", "Tags": ["transit"]},
+  "OTHER_AS65520_v4": {"Name": "Removed", "Tags": null}
+}`), 0644))
+	previous, err := LoadProtocolNames(file)
+	assert.Nil(t, err)
+
+	example := testPeer("EXAMPLE", 65510, "203.0.113.1", "2001:db8::1", "203.0.113.2")
+	other := testPeer("OTHER", 65520, "203.0.113.3")
+	AllocateProtocolNames(map[string]*config.Peer{"Example": example, "Other": other}, previous)
+	assert.Equal(t, []string{"EXAMPLE_AS65510_v4", "EXAMPLE_AS65510_v6", "EXAMPLE_AS65510_v4_1"}, *example.Protocols)
+	assert.Equal(t, []string{"OTHER_AS65520_v4"}, *other.Protocols)
+	assert.Equal(t, "Other", ProtocolNames()["OTHER_AS65520_v4"].Name)
+}